@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mbsoeg/internal/storage"
+	mbssync "mbsoeg/internal/sync"
+)
+
+// parseItemPath splits /items/{itemNum} and /items/{itemNum}/similar paths
+func parseItemPath(path string) (itemNum string, similar bool, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/items/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return parts[0], false, true
+	case len(parts) == 2 && parts[0] != "" && parts[1] == "similar":
+		return parts[0], true, true
+	default:
+		return "", false, false
+	}
+}
+
+// handleItem returns the stored record of an item. The optional sub_item
+// query parameter selects a sub-item.
+func handleItem(w http.ResponseWriter, r *http.Request, storageSvc *storage.Service, itemNum string) {
+	id := storage.PointID(itemNum, r.URL.Query().Get("sub_item"))
+	stored, err := storageSvc.GetItem(r.Context(), id, mbssync.DefaultCollection)
+	if err != nil {
+		log.Printf("Error getting item %s: %v", itemNum, err)
+		http.Error(w, fmt.Sprintf("Failed to get item: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if stored == nil {
+		http.Error(w, fmt.Sprintf("Item %s not found", itemNum), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stored)
+}
+
+// handleSimilar returns the k items most similar to a stored item, using its
+// stored vector so nothing is re-embedded
+func handleSimilar(w http.ResponseWriter, r *http.Request, storageSvc *storage.Service, itemNum string) {
+	k := defaultTopK
+	if value := r.URL.Query().Get("k"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTopK {
+			http.Error(w, fmt.Sprintf("k must be between 1 and %d", maxTopK), http.StatusBadRequest)
+			return
+		}
+		k = n
+	}
+
+	id := storage.PointID(itemNum, r.URL.Query().Get("sub_item"))
+	stored, err := storageSvc.GetPoint(r.Context(), id, mbssync.DefaultCollection)
+	if err != nil {
+		log.Printf("Error getting item %s: %v", itemNum, err)
+		http.Error(w, fmt.Sprintf("Failed to get item: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if stored == nil {
+		http.Error(w, fmt.Sprintf("Item %s not found", itemNum), http.StatusNotFound)
+		return
+	}
+
+	results, err := storageSvc.Similar(r.Context(), id, mbssync.DefaultCollection, storage.SearchOptions{Limit: uint64(k)})
+	if err != nil {
+		log.Printf("Similar items search failed for %s: %v", itemNum, err)
+		http.Error(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Results []storage.SearchResult `json:"results"`
+	}{
+		Results: results,
+	})
+}
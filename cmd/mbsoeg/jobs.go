@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mbsoeg/internal/jobs"
+)
+
+// handleJobs lists recent jobs at /jobs, reports a single job at /jobs/{id},
+// cancels it with DELETE /jobs/{id} and streams its progress at
+// /jobs/{id}/events
+func handleJobs(w http.ResponseWriter, r *http.Request, registry *jobs.Registry) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+	if r.Method == "DELETE" {
+		handleCancelJob(w, registry, id)
+		return
+	}
+	if events, ok := strings.CutSuffix(id, "/events"); ok && events != "" && !strings.Contains(events, "/") {
+		handleJobEvents(w, r, registry, events)
+		return
+	}
+	if id == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Jobs []jobs.Job `json:"jobs"`
+		}{
+			Jobs: registry.List(),
+		})
+		return
+	}
+
+	job, ok := registry.Get(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Job %s not found", id), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleCancelJob cancels a queued or running job and returns its snapshot.
+// A running job reports the cancelled state once its workers have stopped.
+func handleCancelJob(w http.ResponseWriter, registry *jobs.Registry, id string) {
+	if id == "" || strings.Contains(id, "/") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	job, err := registry.Cancel(id)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		http.Error(w, fmt.Sprintf("Job %s not found", id), http.StatusNotFound)
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		http.Error(w, fmt.Sprintf("Job %s has already %s", id, job.State), http.StatusConflict)
+		return
+	}
+	log.Printf("Cancellation requested for job %s", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// progressInterval is the shortest gap between progress events of a job
+const progressInterval = 250 * time.Millisecond
+
+// handleJobEvents streams a job's progress as Server-Sent Events. A "phase"
+// event is sent for every entry in the job's phase log as soon as it is seen,
+// "progress" events carry the job with its counts so far at most every
+// progressInterval, and a final "summary" event carries the finished job
+// before the stream ends.
+func handleJobEvents(w http.ResponseWriter, r *http.Request, registry *jobs.Registry, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub, ok := registry.Subscribe(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Job %s not found", id), http.StatusNotFound)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	phasesSent := 0
+	var lastSent time.Time
+	send := func(final bool) {
+		// The subscription holds the job, so this works even after the job
+		// has left the history
+		job := sub.Snapshot()
+		for _, change := range job.Phases[phasesSent:] {
+			writeEvent(w, "phase", change)
+		}
+		phasesSent = len(job.Phases)
+		if final {
+			writeEvent(w, "summary", job)
+		} else {
+			writeEvent(w, "progress", job)
+			lastSent = time.Now()
+		}
+		flusher.Flush()
+	}
+
+	send(false)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	pending := false
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case _, open := <-sub.Updates():
+			if !open {
+				send(true)
+				return
+			}
+			// Phase changes are not throttled
+			if job := sub.Snapshot(); time.Since(lastSent) >= progressInterval || len(job.Phases) > phasesSent {
+				send(false)
+				pending = false
+			} else {
+				pending = true
+			}
+		case <-ticker.C:
+			if pending {
+				send(false)
+				pending = false
+			}
+		}
+	}
+}
+
+// writeEvent writes a single Server-Sent Event with a JSON payload
+func writeEvent(w io.Writer, event string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", event, err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
@@ -3,20 +3,24 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
-	"sync"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
-	qdrant "github.com/qdrant/go-client/qdrant"
 
 	"mbsoeg/internal/embeddings"
+	"mbsoeg/internal/jobs"
 	"mbsoeg/internal/storage"
+	mbssync "mbsoeg/internal/sync"
 	"mbsoeg/pkg/models"
 )
 
@@ -30,9 +34,13 @@ func main() {
 	serverMode := flag.NewFlagSet("server", flag.ExitOnError)
 	cliMode := flag.NewFlagSet("cli", flag.ExitOnError)
 	jsonFile := cliMode.String("file", "", "Path to MBS items JSON file")
+	dryRun := cliMode.Bool("dry-run", false, "Print the planned changes as JSON without embedding or writing")
+	noDelete := cliMode.Bool("no-delete", false, "Keep stored items that are missing from the file")
+	allowMassDelete := cliMode.Bool("allow-mass-delete", false, "Delete missing items even beyond MAX_DELETE")
+	migrateMode := flag.NewFlagSet("migrate-ids", flag.ExitOnError)
 
 	if len(os.Args) < 2 {
-		log.Fatal("Expected 'server' or 'cli' subcommands")
+		log.Fatal("Expected 'server', 'cli', 'search' or 'migrate-ids' subcommands")
 	}
 
 	switch os.Args[1] {
@@ -41,23 +49,39 @@ func main() {
 		runServer()
 	case "cli":
 		cliMode.Parse(os.Args[2:])
-		runCLI(*jsonFile)
+		runCLI(*jsonFile, *dryRun, mbssync.RunOptions{NoDelete: *noDelete, AllowMassDelete: *allowMassDelete})
+	case "search":
+		runSearchCLI(os.Args[2:])
+	case "migrate-ids":
+		migrateMode.Parse(os.Args[2:])
+		runMigrateIDs()
 	default:
-		log.Fatal("Expected 'server' or 'cli' subcommands")
+		log.Fatal("Expected 'server', 'cli', 'search' or 'migrate-ids' subcommands")
 	}
 }
 
-func runServer() {
-	// Store server start time
-	serverStartTime := time.Now()
-
+// loadConfig builds the configuration from defaults and environment variables
+func loadConfig() models.Config {
 	cfg := models.Config{
-		QdrantHost:   os.Getenv("QDRANT_HOST"),
-		QdrantPort:   6334,
-		NumWorkers:   4,
-		APIKey:       os.Getenv("OPENAI_API_KEY"),
-		ServerPort:   8080,
-		ServerAPIKey: os.Getenv("SERVER_API_KEY"),
+		QdrantHost:        os.Getenv("QDRANT_HOST"),
+		QdrantPort:        6334,
+		NumWorkers:        4,
+		APIKey:            os.Getenv("OPENAI_API_KEY"),
+		ServerPort:        8080,
+		ServerAPIKey:      os.Getenv("SERVER_API_KEY"),
+		EmbeddingProvider: "openai",
+		VectorDistance:    "cosine",
+
+		EmbeddingBatchSize:   embeddings.DefaultBatchSize,
+		EmbeddingBatchTokens: embeddings.DefaultBatchTokens,
+
+		QdrantWriteBatchSize: mbssync.DefaultWriteBatchSize,
+		QdrantFlushInterval:  mbssync.DefaultFlushInterval,
+		QdrantWriteOrdering:  "weak",
+
+		JobHistory:      jobs.DefaultHistory,
+		SyncConcurrency: string(jobs.PolicyQueue),
+		MaxDelete:       mbssync.DefaultMaxDelete,
 	}
 
 	// Override defaults with environment variables if set
@@ -76,37 +100,215 @@ func runServer() {
 			cfg.ServerPort = p
 		}
 	}
+	if timeout := os.Getenv("EMBEDDING_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			cfg.EmbeddingTimeout = t
+		}
+	}
+	if timeout := os.Getenv("QDRANT_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			cfg.QdrantTimeout = t
+		}
+	}
+	if provider := os.Getenv("EMBEDDING_PROVIDER"); provider != "" {
+		cfg.EmbeddingProvider = provider
+	}
+	if key := os.Getenv("EMBEDDING_API_KEY"); key != "" {
+		cfg.APIKey = key
+	}
+	cfg.EmbeddingModel = os.Getenv("EMBEDDING_MODEL")
+	cfg.EmbeddingBaseURL = os.Getenv("EMBEDDING_BASE_URL")
+	cfg.EmbeddingAPIVersion = os.Getenv("EMBEDDING_API_VERSION")
+	cfg.EmbeddingCachePath = os.Getenv("EMBEDDING_CACHE_PATH")
+	if dim := os.Getenv("EMBEDDING_DIMENSION"); dim != "" {
+		if d, err := strconv.Atoi(dim); err == nil {
+			cfg.EmbeddingDimension = d
+		}
+	}
+	if distance := os.Getenv("QDRANT_DISTANCE"); distance != "" {
+		cfg.VectorDistance = distance
+	}
+	if attempts := os.Getenv("EMBEDDING_MAX_ATTEMPTS"); attempts != "" {
+		if a, err := strconv.Atoi(attempts); err == nil {
+			cfg.EmbeddingMaxAttempts = a
+		}
+	}
+	if wait := os.Getenv("EMBEDDING_MAX_RETRY_WAIT"); wait != "" {
+		if w, err := time.ParseDuration(wait); err == nil {
+			cfg.EmbeddingMaxWait = w
+		}
+	}
+	if rpm := os.Getenv("EMBEDDING_RPM"); rpm != "" {
+		if r, err := strconv.Atoi(rpm); err == nil {
+			cfg.EmbeddingRPM = r
+		}
+	}
+	if tpm := os.Getenv("EMBEDDING_TPM"); tpm != "" {
+		if t, err := strconv.Atoi(tpm); err == nil {
+			cfg.EmbeddingTPM = t
+		}
+	}
+	if size := os.Getenv("EMBEDDING_BATCH_SIZE"); size != "" {
+		if b, err := strconv.Atoi(size); err == nil {
+			cfg.EmbeddingBatchSize = b
+		}
+	}
+	if tokens := os.Getenv("EMBEDDING_BATCH_TOKENS"); tokens != "" {
+		if t, err := strconv.Atoi(tokens); err == nil {
+			cfg.EmbeddingBatchTokens = t
+		}
+	}
+	if size := os.Getenv("QDRANT_WRITE_BATCH_SIZE"); size != "" {
+		if b, err := strconv.Atoi(size); err == nil {
+			cfg.QdrantWriteBatchSize = b
+		}
+	}
+	if interval := os.Getenv("QDRANT_FLUSH_INTERVAL"); interval != "" {
+		if i, err := time.ParseDuration(interval); err == nil {
+			cfg.QdrantFlushInterval = i
+		}
+	}
+	if wait := os.Getenv("QDRANT_WAIT"); wait != "" {
+		if w, err := strconv.ParseBool(wait); err == nil {
+			cfg.QdrantWait = w
+		}
+	}
+	if ordering := os.Getenv("QDRANT_WRITE_ORDERING"); ordering != "" {
+		cfg.QdrantWriteOrdering = ordering
+	}
+	if history := os.Getenv("JOB_HISTORY"); history != "" {
+		if h, err := strconv.Atoi(history); err == nil {
+			cfg.JobHistory = h
+		}
+	}
+	if policy := os.Getenv("SYNC_CONCURRENCY"); policy != "" {
+		cfg.SyncConcurrency = policy
+	}
+	if limit, ok := os.LookupEnv("MAX_DELETE"); ok {
+		cfg.MaxDelete = limit
+	}
+
+	return cfg
+}
+
+// newEmbeddingsService creates the configured embeddings provider and validates it
+func newEmbeddingsService(ctx context.Context, cfg models.Config) *embeddings.Service {
+	embeddingsSvc, err := embeddings.NewService(embeddingsConfig(cfg))
+	if err != nil {
+		log.Fatalf("Failed to initialize embeddings service: %v", err)
+	}
+	if err := embeddingsSvc.ValidateAPIKey(ctx); err != nil {
+		log.Fatalf("Invalid embeddings provider configuration: %v", err)
+	}
+	return embeddingsSvc
+}
+
+// embeddingsConfig builds the embeddings provider configuration
+func embeddingsConfig(cfg models.Config) embeddings.Config {
+	return embeddings.Config{
+		Provider:   cfg.EmbeddingProvider,
+		Model:      cfg.EmbeddingModel,
+		APIKey:     cfg.APIKey,
+		BaseURL:    cfg.EmbeddingBaseURL,
+		APIVersion: cfg.EmbeddingAPIVersion,
+		Dimension:  cfg.EmbeddingDimension,
+
+		MaxAttempts:  cfg.EmbeddingMaxAttempts,
+		MaxRetryWait: cfg.EmbeddingMaxWait,
+		Timeout:      cfg.EmbeddingTimeout,
+		CachePath:    cfg.EmbeddingCachePath,
+		RateLimit: embeddings.RateLimit{
+			RequestsPerMinute: cfg.EmbeddingRPM,
+			TokensPerMinute:   cfg.EmbeddingTPM,
+		},
+	}
+}
+
+// initializeCollection creates or checks the collection for the embedding model's vectors
+func initializeCollection(ctx context.Context, cfg models.Config, embeddingsSvc *embeddings.Service, storageSvc *storage.Service) error {
+	vectorSize := embeddingsSvc.Dimension()
+	if vectorSize <= 0 {
+		return fmt.Errorf("vector size of %s is unknown, set EMBEDDING_DIMENSION", embeddingsSvc.ModelID())
+	}
+
+	distance, err := storage.ParseDistance(cfg.VectorDistance)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Using %d-dimensional %s vectors with %s distance", vectorSize, embeddingsSvc.ModelID(), distance)
+	return storageSvc.InitializeCollection(ctx, uint64(vectorSize), distance)
+}
+
+// newSyncer creates the sync engine shared by the server and CLI
+func newSyncer(cfg models.Config, embeddingsSvc *embeddings.Service, storageSvc *storage.Service) *mbssync.Syncer {
+	ordering, err := storage.ParseWriteOrdering(cfg.QdrantWriteOrdering)
+	if err != nil {
+		log.Fatalf("Invalid Qdrant configuration: %v", err)
+	}
+	maxDelete, err := mbssync.ParseDeleteLimit(cfg.MaxDelete)
+	if err != nil {
+		log.Fatalf("Invalid MAX_DELETE: %v", err)
+	}
+
+	return mbssync.New(embeddingsSvc, storageSvc, mbssync.Options{
+		NumWorkers:  cfg.NumWorkers,
+		BatchSize:   cfg.EmbeddingBatchSize,
+		BatchTokens: cfg.EmbeddingBatchTokens,
+
+		WriteBatchSize: cfg.QdrantWriteBatchSize,
+		FlushInterval:  cfg.QdrantFlushInterval,
+		Write: storage.WriteOptions{
+			Wait:     cfg.QdrantWait,
+			Ordering: ordering,
+		},
+		MaxDelete: maxDelete,
+	})
+}
+
+func runServer() {
+	// Store server start time
+	serverStartTime := time.Now()
+
+	cfg := loadConfig()
 
 	log.Printf("Starting server with config: QdrantHost=%s, QdrantPort=%d, NumWorkers=%d, ServerPort=%d",
 		cfg.QdrantHost, cfg.QdrantPort, cfg.NumWorkers, cfg.ServerPort)
 
+	// SIGINT or SIGTERM cancels running jobs and shuts the server down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize services
-	log.Printf("Initializing OpenAI embeddings service...")
-	embeddingsSvc := embeddings.NewService(cfg.APIKey)
-	if err := embeddingsSvc.ValidateAPIKey(); err != nil {
-		log.Fatalf("Invalid OpenAI API key: %v", err)
+	log.Printf("Initializing %s embeddings service...", cfg.EmbeddingProvider)
+	embeddingsSvc := newEmbeddingsService(ctx, cfg)
+	defer embeddingsSvc.Close()
+	log.Printf("Embeddings provider %s validated successfully", embeddingsSvc.ModelID())
+	if cfg.EmbeddingCachePath != "" {
+		log.Printf("Using embedding cache at %s", cfg.EmbeddingCachePath)
 	}
-	log.Printf("OpenAI API key validated successfully")
 
 	log.Printf("Connecting to Qdrant at %s:%d...", cfg.QdrantHost, cfg.QdrantPort)
-	storageSvc, err := storage.NewService(cfg.QdrantHost, cfg.QdrantPort)
+	storageSvc, err := storage.NewService(cfg.QdrantHost, cfg.QdrantPort, cfg.QdrantTimeout)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage service: %v", err)
 	}
 	log.Printf("Connected to Qdrant successfully")
 
 	// Initialize collection
-	ctx := context.Background()
 	log.Printf("Initializing Qdrant collection...")
-	if err := storageSvc.InitializeCollection(ctx); err != nil {
+	if err := initializeCollection(ctx, cfg, embeddingsSvc, storageSvc); err != nil {
 		log.Fatalf("Failed to initialize collection: %v", err)
 	}
 	log.Printf("Qdrant collection initialized successfully")
 
-	// Track last request time and processing status
-	var lastRequestTime *time.Time
-	var isProcessing bool
-	var processingMu sync.Mutex
+	// Sync jobs run in the background, outliving the request that started them
+	syncer := newSyncer(cfg, embeddingsSvc, storageSvc)
+	policy, err := jobs.ParsePolicy(cfg.SyncConcurrency)
+	if err != nil {
+		log.Fatalf("Invalid SYNC_CONCURRENCY: %v", err)
+	}
+	registry := jobs.NewRegistry(ctx, syncer, cfg.JobHistory, policy)
 
 	// Create a new HTTP server
 	server := &http.Server{
@@ -114,8 +316,8 @@ func runServer() {
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Add CORS headers
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 
 			// Handle preflight requests
 			if r.Method == "OPTIONS" {
@@ -125,7 +327,6 @@ func runServer() {
 
 			// Handle health check endpoint
 			if r.Method == "GET" && r.URL.Path == "/" {
-				processingMu.Lock()
 				status := struct {
 					Status       string    `json:"status"`
 					StartTime    time.Time `json:"start_time"`
@@ -133,34 +334,35 @@ func runServer() {
 					LastRequest  time.Time `json:"last_request,omitempty"`
 					IsProcessing bool      `json:"is_processing"`
 					Config       struct {
-						QdrantHost string `json:"qdrant_host"`
-						QdrantPort int    `json:"qdrant_port"`
-						NumWorkers int    `json:"num_workers"`
-						ServerPort int    `json:"server_port"`
+						QdrantHost     string `json:"qdrant_host"`
+						QdrantPort     int    `json:"qdrant_port"`
+						NumWorkers     int    `json:"num_workers"`
+						ServerPort     int    `json:"server_port"`
+						EmbeddingModel string `json:"embedding_model"`
+						VectorSize     int    `json:"vector_size"`
 					} `json:"config"`
 				}{
 					Status:       "up",
 					StartTime:    serverStartTime,
 					Uptime:       time.Since(serverStartTime).String(),
-					IsProcessing: isProcessing,
+					IsProcessing: registry.Active() > 0,
 					Config: struct {
-						QdrantHost string `json:"qdrant_host"`
-						QdrantPort int    `json:"qdrant_port"`
-						NumWorkers int    `json:"num_workers"`
-						ServerPort int    `json:"server_port"`
+						QdrantHost     string `json:"qdrant_host"`
+						QdrantPort     int    `json:"qdrant_port"`
+						NumWorkers     int    `json:"num_workers"`
+						ServerPort     int    `json:"server_port"`
+						EmbeddingModel string `json:"embedding_model"`
+						VectorSize     int    `json:"vector_size"`
 					}{
-						QdrantHost: cfg.QdrantHost,
-						QdrantPort: cfg.QdrantPort,
-						NumWorkers: cfg.NumWorkers,
-						ServerPort: cfg.ServerPort,
+						QdrantHost:     cfg.QdrantHost,
+						QdrantPort:     cfg.QdrantPort,
+						NumWorkers:     cfg.NumWorkers,
+						ServerPort:     cfg.ServerPort,
+						EmbeddingModel: embeddingsSvc.ModelID(),
+						VectorSize:     embeddingsSvc.Dimension(),
 					},
 				}
-				processingMu.Unlock()
-
-				// If there's an active request, include its timestamp
-				if lastRequestTime != nil {
-					status.LastRequest = *lastRequestTime
-				}
+				status.LastRequest = registry.LastSubmit()
 
 				w.Header().Set("Content-Type", "application/json")
 				json.NewEncoder(w).Encode(status)
@@ -169,20 +371,6 @@ func runServer() {
 
 			// Handle /process endpoint
 			if r.Method == "POST" && r.URL.Path == "/process" {
-				// Update processing status
-				processingMu.Lock()
-				isProcessing = true
-				processingMu.Unlock()
-				defer func() {
-					processingMu.Lock()
-					isProcessing = false
-					processingMu.Unlock()
-				}()
-
-				// Update last request time
-				now := time.Now()
-				lastRequestTime = &now
-
 				// Validate API key
 				apiKey := r.Header.Get("X-API-Key")
 				if apiKey != cfg.ServerAPIKey {
@@ -204,191 +392,99 @@ func runServer() {
 				}
 				log.Printf("Successfully parsed request body with %d items", len(request.MBS_Items))
 
-				// Process items
-				var skippedCount, updatedCount int
-				var mu sync.Mutex
-				currentItems := make(map[string]bool)
-
-				// Get existing points from Qdrant
-				log.Printf("Getting existing points from Qdrant...")
-				existingPoints, err := storageSvc.ScrollPoints(ctx, "descriptions")
-				if err != nil {
-					log.Printf("Failed to get existing points: %v", err)
-					http.Error(w, fmt.Sprintf("Failed to get existing points: %v", err), http.StatusInternalServerError)
+				// Deletion can be turned off with mode=upsert-only, and the
+				// deletion limit lifted with allow_mass_delete=true
+				query := r.URL.Query()
+				runOpts := mbssync.RunOptions{AllowMassDelete: query.Get("allow_mass_delete") == "true"}
+				switch mode := query.Get("mode"); mode {
+				case "", "sync":
+				case "upsert-only":
+					runOpts.NoDelete = true
+				default:
+					http.Error(w, fmt.Sprintf("Invalid mode %q, expected sync or upsert-only", mode), http.StatusBadRequest)
 					return
 				}
-				log.Printf("Got %d existing points from Qdrant", len(existingPoints))
-
-				// Create worker pool
-				jobs := make(chan models.EmbeddingJob, len(request.MBS_Items))
-				resultsChan := make(chan models.EmbeddingResult, len(request.MBS_Items))
-
-				// Start workers
-				var wg sync.WaitGroup
-				for w := 1; w <= cfg.NumWorkers; w++ {
-					wg.Add(1)
-					go func(workerID int) {
-						defer wg.Done()
-						for job := range jobs {
-							log.Printf("Worker %d processing item %s", workerID, job.ItemNum)
-							vector, err := embeddingsSvc.GetEmbedding(fmt.Sprintf("MBS Item %s: %s", job.ItemNum, job.Item.Description))
-							resultsChan <- models.EmbeddingResult{
-								ItemNum: job.ItemNum,
-								Vector:  vector,
-								Item:    job.Item,
-								NewHash: job.NewHash,
-								Error:   err,
-							}
-						}
-					}(w)
-				}
-
-				// Queue jobs for items that need processing
-				jobCount := 0
-				for i, item := range request.MBS_Items {
-					log.Printf("Checking item %d/%d: %s", i+1, len(request.MBS_Items), item.ItemNum)
-					currentItems[item.ItemNum] = true
 
-					// Check if item needs updating
-					descHash := storageSvc.GenerateHash(item)
-					point, err := storageSvc.GetPoint(ctx, item.ItemNum, "descriptions")
+				// A dry run returns the planned changes without embedding or writing
+				if query.Get("dry_run") == "true" {
+					plan, err := syncer.DryRun(r.Context(), request.MBS_Items, runOpts)
 					if err != nil {
-						log.Printf("Error getting point for item %s: %v", item.ItemNum, err)
-						continue
-					}
-
-					if point != nil {
-						payload := point.Payload
-						if hashValue, ok := payload["_hash"]; ok {
-							if hash, ok := hashValue.GetKind().(*qdrant.Value_StringValue); ok {
-								if hash.StringValue == descHash {
-									log.Printf("Skipping unchanged item %s (hash: %s)", item.ItemNum, descHash)
-									mu.Lock()
-									skippedCount++
-									mu.Unlock()
-									continue
-								}
-								log.Printf("Item %s has changed (old hash: %s, new hash: %s)", item.ItemNum, hash.StringValue, descHash)
-							}
-						}
-					} else {
-						log.Printf("Item %s is new (hash: %s)", item.ItemNum, descHash)
+						log.Printf("Dry run failed: %v", err)
+						http.Error(w, fmt.Sprintf("Dry run failed: %v", err), http.StatusInternalServerError)
+						return
 					}
+					w.Header().Set("Content-Type", "application/json")
+					json.NewEncoder(w).Encode(plan)
+					return
+				}
 
-					jobs <- models.EmbeddingJob{
-						ItemNum: item.ItemNum,
-						Text:    fmt.Sprintf("MBS Item %s: %s", item.ItemNum, item.Description),
-						Item:    item,
-						NewHash: descHash,
-					}
-					jobCount++
+				// Run the sync in the background and return its job
+				job, err := registry.Submit(request.MBS_Items, runOpts)
+				var busy *jobs.BusyError
+				if errors.As(err, &busy) {
+					log.Printf("Rejected sync request: %v", err)
+					w.Header().Set("Location", "/jobs/"+busy.JobID)
+					http.Error(w, err.Error(), http.StatusConflict)
+					return
 				}
-				close(jobs)
-				log.Printf("Queued %d items for processing", jobCount)
-
-				// Process results
-				go func() {
-					for result := range resultsChan {
-						if result.Error != nil {
-							log.Printf("Error processing item %s: %v", result.ItemNum, result.Error)
-							continue
-						}
-
-						// Store in Qdrant
-						log.Printf("Storing item %s in Qdrant...", result.ItemNum)
-						payload := map[string]interface{}{
-							// Metadata fields
-							"_hash":       result.NewHash,
-							"_last_check": time.Now().Format(time.RFC3339),
-
-							// Required fields
-							"item_num":               result.Item.ItemNum,
-							"description":            result.Item.Description,
-							"new_item":               result.Item.NewItem,
-							"item_change":            result.Item.ItemChange,
-							"fee_change":             result.Item.FeeChange,
-							"benefit_change":         result.Item.BenefitChange,
-							"anaes_change":           result.Item.AnaesChange,
-							"emsn_change":            result.Item.EMSNChange,
-							"descriptor_change":      result.Item.DescriptorChange,
-							"anaes":                  result.Item.Anaes,
-							"item_start_date":        result.Item.ItemStartDate,
-							"item_end_date":          result.Item.ItemEndDate,
-							"fee_start_date":         result.Item.FeeStartDate,
-							"benefit_start_date":     result.Item.BenefitStartDate,
-							"description_start_date": result.Item.DescriptionStartDate,
-							"emsn_start_date":        result.Item.EMSNStartDate,
-							"emsn_end_date":          result.Item.EMSNEndDate,
-							"qfe_start_date":         result.Item.QFEStartDate,
-							"qfe_end_date":           result.Item.QFEEndDate,
-							"derived_fee_start_date": result.Item.DerivedFeeStartDate,
-							"emsn_change_date":       result.Item.EMSNChangeDate,
-							"schedule_fee":           result.Item.ScheduleFee,
-							"derived_fee":            result.Item.DerivedFee,
-							"benefit_75":             result.Item.Benefit75,
-							"benefit_85":             result.Item.Benefit85,
-							"benefit_100":            result.Item.Benefit100,
-							"emsn_percentage_cap":    result.Item.EMSNPercentageCap,
-							"emsn_maximum_cap":       result.Item.EMSNMaximumCap,
-							"emsn_fixed_cap_amount":  result.Item.EMSNFixedCapAmount,
-							"emsn_cap":               result.Item.EMSNCap,
-							"basic_units":            result.Item.BasicUnits,
-							"category":               result.Item.Category,
-							"group":                  result.Item.Group,
-							"sub_group":              result.Item.SubGroup,
-							"sub_heading":            result.Item.SubHeading,
-							"item_type":              result.Item.ItemType,
-							"sub_item_num":           result.Item.SubItemNum,
-							"benefit_type":           result.Item.BenefitType,
-							"fee_type":               result.Item.FeeType,
-							"provider_type":          result.Item.ProviderType,
-							"emsn_description":       result.Item.EMSNDescription,
-						}
-						if err := storageSvc.UpsertPoint(ctx, result.ItemNum, result.Vector, payload, "descriptions"); err != nil {
-							log.Printf("Error upserting point for item %s: %v", result.ItemNum, err)
-							continue
-						}
-
-						mu.Lock()
-						updatedCount++
-						mu.Unlock()
-					}
-				}()
-
-				// Wait for all workers to finish
-				wg.Wait()
-				close(resultsChan)
-
-				// Remove items that no longer exist
-				var removedCount int
-				for _, point := range existingPoints {
-					itemNum := fmt.Sprintf("%d", point.Id.GetNum())
-					if !currentItems[itemNum] {
-						if err := storageSvc.DeletePoint(ctx, itemNum, "descriptions"); err != nil {
-							log.Printf("Error deleting point for item %s: %v", itemNum, err)
-							continue
-						}
-						removedCount++
-					}
+				if err != nil {
+					log.Printf("Failed to start job: %v", err)
+					http.Error(w, fmt.Sprintf("Failed to start job: %v", err), http.StatusInternalServerError)
+					return
 				}
+				log.Printf("Accepted job %s with %d items", job.ID, job.Items)
 
-				// Print summary
-				log.Printf("Processing complete:")
-				log.Printf("- Items processed: %d", len(request.MBS_Items))
-				log.Printf("- Items skipped (unchanged): %d", skippedCount)
-				log.Printf("- Items updated: %d", updatedCount)
-				log.Printf("- Items removed: %d", removedCount)
-
-				// Return response
 				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"status":        "success",
-					"total_items":   len(request.MBS_Items),
-					"skipped_items": skippedCount,
-					"updated_items": updatedCount,
-					"removed_items": removedCount,
+				w.Header().Set("Location", "/jobs/"+job.ID)
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(struct {
+					Status    string `json:"status"`
+					JobID     string `json:"job_id"`
+					StatusURL string `json:"status_url"`
+				}{
+					Status:    "accepted",
+					JobID:     job.ID,
+					StatusURL: "/jobs/" + job.ID,
 				})
-				log.Printf("Request completed successfully")
+				return
+			}
+
+			// Handle /jobs and /jobs/{id} endpoints, and DELETE /jobs/{id} to cancel
+			if (r.Method == "GET" || r.Method == "DELETE") && (r.URL.Path == "/jobs" || strings.HasPrefix(r.URL.Path, "/jobs/")) {
+				if r.Header.Get("X-API-Key") != cfg.ServerAPIKey {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				handleJobs(w, r, registry)
+				return
+			}
+
+			// Handle /search endpoint
+			if r.Method == "POST" && r.URL.Path == "/search" {
+				if r.Header.Get("X-API-Key") != cfg.ServerAPIKey {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				handleSearch(w, r, embeddingsSvc, storageSvc)
+				return
+			}
+
+			// Handle /items/{itemNum} and /items/{itemNum}/similar endpoints
+			if r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/items/") {
+				itemNum, similar, ok := parseItemPath(r.URL.Path)
+				if !ok {
+					http.Error(w, "Not found", http.StatusNotFound)
+					return
+				}
+				if r.Header.Get("X-API-Key") != cfg.ServerAPIKey {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				if similar {
+					handleSimilar(w, r, storageSvc, itemNum)
+				} else {
+					handleItem(w, r, storageSvc, itemNum)
+				}
 				return
 			}
 
@@ -398,13 +494,31 @@ func runServer() {
 	}
 
 	// Start the server
-	log.Printf("Starting server on port %d...", cfg.ServerPort)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Server error: %v", err)
+	go func() {
+		log.Printf("Starting server on port %d...", cfg.ServerPort)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	// On a signal, stop accepting requests and let the running job stop its
+	// workers. Event streams end once their job has finished.
+	<-ctx.Done()
+	stop()
+	log.Printf("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
 	}
+	registry.Wait()
+	log.Printf("Server stopped")
 }
 
-func runCLI(jsonFile string) {
+// shutdownTimeout is how long the server waits for open requests on shutdown
+const shutdownTimeout = 30 * time.Second
+
+func runCLI(jsonFile string, dryRun bool, runOpts mbssync.RunOptions) {
 	if jsonFile == "" {
 		log.Fatal("Please provide a path to the MBS items JSON file using the -file flag")
 	}
@@ -428,228 +542,77 @@ func runCLI(jsonFile string) {
 	}
 
 	// Initialize services
-	cfg := models.Config{
-		QdrantHost:   os.Getenv("QDRANT_HOST"),
-		QdrantPort:   6334,
-		NumWorkers:   4,
-		APIKey:       os.Getenv("OPENAI_API_KEY"),
-		ServerPort:   8080,
-		ServerAPIKey: os.Getenv("SERVER_API_KEY"),
-	}
+	cfg := loadConfig()
 
-	// Override defaults with environment variables if set
-	if port := os.Getenv("QDRANT_PORT"); port != "" {
-		if p, err := strconv.Atoi(port); err == nil {
-			cfg.QdrantPort = p
-		}
-	}
-	if workers := os.Getenv("NUM_WORKERS"); workers != "" {
-		if w, err := strconv.Atoi(workers); err == nil {
-			cfg.NumWorkers = w
+	// Cancel the sync cleanly on Ctrl-C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// A dry run only reads from Qdrant, so the embeddings provider is not needed
+	if dryRun {
+		storageSvc, err := storage.NewService(cfg.QdrantHost, cfg.QdrantPort, cfg.QdrantTimeout)
+		if err != nil {
+			log.Fatalf("Failed to initialize storage service: %v", err)
 		}
-	}
-	if port := os.Getenv("SERVER_PORT"); port != "" {
-		if p, err := strconv.Atoi(port); err == nil {
-			cfg.ServerPort = p
+		plan, err := newSyncer(cfg, nil, storageSvc).DryRun(ctx, items, runOpts)
+		if err != nil {
+			log.Fatalf("Dry run failed: %v", err)
 		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(plan)
+		return
 	}
 
-	// Validate OpenAI API key
-	embeddingsSvc := embeddings.NewService(cfg.APIKey)
-	if err := embeddingsSvc.ValidateAPIKey(); err != nil {
-		log.Fatalf("Invalid OpenAI API key: %v", err)
-	}
+	// Initialize and validate the embeddings provider
+	embeddingsSvc := newEmbeddingsService(ctx, cfg)
+	defer embeddingsSvc.Close()
 
 	// Initialize storage service
-	storageSvc, err := storage.NewService(cfg.QdrantHost, cfg.QdrantPort)
+	storageSvc, err := storage.NewService(cfg.QdrantHost, cfg.QdrantPort, cfg.QdrantTimeout)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage service: %v", err)
 	}
 
 	// Initialize collection
-	ctx := context.Background()
-	if err := storageSvc.InitializeCollection(ctx); err != nil {
+	if err := initializeCollection(ctx, cfg, embeddingsSvc, storageSvc); err != nil {
 		log.Fatalf("Failed to initialize collection: %v", err)
 	}
 
-	// Process items
-	var skippedCount, updatedCount int
-	var mu sync.Mutex
-	currentItems := make(map[string]bool)
-
-	// Create channels for the worker pool
-	jobs := make(chan models.EmbeddingJob, len(items))
-	results := make(chan models.EmbeddingResult, len(items))
-
-	// Start workers
-	var wg sync.WaitGroup
-	for w := 1; w <= cfg.NumWorkers; w++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			for job := range jobs {
-				if cfg.NumWorkers > 1 {
-					log.Printf("Worker %d processing item %s", workerID, job.ItemNum)
-				}
-				vector, err := embeddingsSvc.GetEmbedding(fmt.Sprintf("MBS Item %s: %s", job.ItemNum, job.Item.Description))
-				results <- models.EmbeddingResult{
-					ItemNum: job.ItemNum,
-					Vector:  vector,
-					Item:    job.Item,
-					NewHash: job.NewHash,
-					Error:   err,
-				}
-			}
-		}(w)
-	}
-
-	// Process existing items
-	existingPoints, err := storageSvc.ScrollPoints(ctx, "descriptions")
-	if err != nil {
-		log.Fatalf("Failed to get existing points: %v", err)
-	}
-
-	existingItems := make(map[string]bool)
-	for _, point := range existingPoints {
-		itemNum := fmt.Sprintf("%d", point.Id.GetNum())
-		existingItems[itemNum] = true
-	}
-
-	// Queue jobs for items that need processing
-	jobCount := 0
-	for _, item := range items {
-		currentItems[item.ItemNum] = true
-		descHash := storageSvc.GenerateHash(item)
-
-		// Get existing point to check hash
-		point, err := storageSvc.GetPoint(ctx, item.ItemNum, "descriptions")
-		if err != nil {
-			log.Printf("Error getting point for item %s: %v", item.ItemNum, err)
-			continue
-		}
-
-		if point != nil {
-			payload := point.Payload
-			if hashValue, ok := payload["_hash"]; ok {
-				if hash, ok := hashValue.GetKind().(*qdrant.Value_StringValue); ok {
-					if hash.StringValue == descHash {
-						mu.Lock()
-						skippedCount++
-						mu.Unlock()
-						continue
-					}
-					log.Printf("Item %s has changed (old hash: %s, new hash: %s)", item.ItemNum, hash.StringValue, descHash)
-				}
-			}
-		} else {
-			log.Printf("Item %s is new (hash: %s)", item.ItemNum, descHash)
-		}
-
-		jobs <- models.EmbeddingJob{
-			ItemNum: item.ItemNum,
-			Text:    fmt.Sprintf("MBS Item %s: %s", item.ItemNum, item.Description),
-			Item:    item,
-			NewHash: descHash,
+	// Sync items
+	syncer := newSyncer(cfg, embeddingsSvc, storageSvc)
+	if _, err := syncer.Run(ctx, items, runOpts); err != nil {
+		var massDelete *mbssync.MassDeleteError
+		if errors.As(err, &massDelete) && massDelete.Legacy == 0 {
+			log.Fatalf("Processing aborted: %v (use --allow-mass-delete or --no-delete)", err)
 		}
-		jobCount++
+		log.Fatalf("Processing failed: %v", err)
 	}
-	close(jobs)
+}
 
-	// Process results
-	for i := 0; i < jobCount; i++ {
-		result := <-results
-		if result.Error != nil {
-			log.Printf("Error processing item %s: %v", result.ItemNum, result.Error)
-			continue
-		}
+// runMigrateIDs moves points with numeric IDs from earlier versions to UUID point IDs
+func runMigrateIDs() {
+	cfg := loadConfig()
 
-		// Create a map of individual fields for the payload
-		payload := map[string]interface{}{
-			// Metadata fields
-			"_hash":       result.NewHash,
-			"_last_check": time.Now().Format(time.RFC3339),
-
-			// Required fields
-			"item_num":    result.Item.ItemNum,
-			"description": result.Item.Description,
-
-			// Boolean fields
-			"new_item":          result.Item.NewItem,
-			"item_change":       result.Item.ItemChange,
-			"fee_change":        result.Item.FeeChange,
-			"benefit_change":    result.Item.BenefitChange,
-			"anaes_change":      result.Item.AnaesChange,
-			"emsn_change":       result.Item.EMSNChange,
-			"descriptor_change": result.Item.DescriptorChange,
-			"anaes":             result.Item.Anaes,
-
-			// Date fields
-			"item_start_date":        result.Item.ItemStartDate,
-			"item_end_date":          result.Item.ItemEndDate,
-			"fee_start_date":         result.Item.FeeStartDate,
-			"benefit_start_date":     result.Item.BenefitStartDate,
-			"description_start_date": result.Item.DescriptionStartDate,
-			"emsn_start_date":        result.Item.EMSNStartDate,
-			"emsn_end_date":          result.Item.EMSNEndDate,
-			"qfe_start_date":         result.Item.QFEStartDate,
-			"qfe_end_date":           result.Item.QFEEndDate,
-			"derived_fee_start_date": result.Item.DerivedFeeStartDate,
-			"emsn_change_date":       result.Item.EMSNChangeDate,
-
-			// Float/numeric fields
-			"schedule_fee":          result.Item.ScheduleFee,
-			"derived_fee":           result.Item.DerivedFee,
-			"benefit_75":            result.Item.Benefit75,
-			"benefit_85":            result.Item.Benefit85,
-			"benefit_100":           result.Item.Benefit100,
-			"emsn_percentage_cap":   result.Item.EMSNPercentageCap,
-			"emsn_maximum_cap":      result.Item.EMSNMaximumCap,
-			"emsn_fixed_cap_amount": result.Item.EMSNFixedCapAmount,
-			"emsn_cap":              result.Item.EMSNCap,
-			"basic_units":           result.Item.BasicUnits,
-
-			// String fields
-			"category":         result.Item.Category,
-			"group":            result.Item.Group,
-			"sub_group":        result.Item.SubGroup,
-			"sub_heading":      result.Item.SubHeading,
-			"item_type":        result.Item.ItemType,
-			"sub_item_num":     result.Item.SubItemNum,
-			"benefit_type":     result.Item.BenefitType,
-			"fee_type":         result.Item.FeeType,
-			"provider_type":    result.Item.ProviderType,
-			"emsn_description": result.Item.EMSNDescription,
-		}
-		if err := storageSvc.UpsertPoint(ctx, result.ItemNum, result.Vector, payload, "descriptions"); err != nil {
-			log.Printf("Error upserting point for item %s: %v", result.ItemNum, err)
-			continue
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		mu.Lock()
-		updatedCount++
-		mu.Unlock()
+	storageSvc, err := storage.NewService(cfg.QdrantHost, cfg.QdrantPort, cfg.QdrantTimeout)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage service: %v", err)
 	}
 
-	// Wait for all workers to finish
-	wg.Wait()
-	close(results)
-
-	// Remove items that no longer exist
-	var removedCount int
-	for itemNum := range existingItems {
-		if !currentItems[itemNum] {
-			if err := storageSvc.DeletePoint(ctx, itemNum, "descriptions"); err != nil {
-				log.Printf("Error deleting point for item %s: %v", itemNum, err)
-				continue
-			}
-			removedCount++
-		}
+	ordering, err := storage.ParseWriteOrdering(cfg.QdrantWriteOrdering)
+	if err != nil {
+		log.Fatalf("Invalid Qdrant configuration: %v", err)
 	}
 
-	// Print summary
-	log.Printf("Processing complete:")
-	log.Printf("- Items processed: %d", len(items))
-	log.Printf("- Items skipped (unchanged): %d", skippedCount)
-	log.Printf("- Items updated: %d", updatedCount)
-	log.Printf("- Items removed: %d", removedCount)
+	migrated, err := storageSvc.MigratePointIDs(ctx, mbssync.DefaultCollection, cfg.QdrantWriteBatchSize, storage.WriteOptions{
+		Wait:     true,
+		Ordering: ordering,
+	})
+	if err != nil {
+		log.Fatalf("Migration failed after %d points: %v", migrated, err)
+	}
+	log.Printf("Migrated %d points to UUID point IDs", migrated)
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"mbsoeg/internal/embeddings"
+	"mbsoeg/internal/storage"
+	mbssync "mbsoeg/internal/sync"
+)
+
+// Search result limits
+const (
+	defaultTopK = 10
+	maxTopK     = 100
+)
+
+// searchRequest is the body of POST /search
+type searchRequest struct {
+	Text           string         `json:"text"`
+	TopK           int            `json:"top_k"`
+	ScoreThreshold *float32       `json:"score_threshold,omitempty"`
+	Filter         storage.Filter `json:"filter"`
+}
+
+// handleSearch embeds the query text with the collection's model and returns
+// the closest items with their scores
+func handleSearch(w http.ResponseWriter, r *http.Request, embeddingsSvc *embeddings.Service, storageSvc *storage.Service) {
+	var request searchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	request.Text = strings.TrimSpace(request.Text)
+	if request.Text == "" {
+		http.Error(w, "Search text is required", http.StatusBadRequest)
+		return
+	}
+	if request.TopK <= 0 {
+		request.TopK = defaultTopK
+	}
+	if request.TopK > maxTopK {
+		http.Error(w, fmt.Sprintf("top_k must be at most %d", maxTopK), http.StatusBadRequest)
+		return
+	}
+	if err := request.Filter.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid filter: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	vector, err := embeddingsSvc.EmbedQuery(r.Context(), request.Text)
+	if err != nil {
+		log.Printf("Error embedding search text: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to embed search text: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	results, err := storageSvc.Search(r.Context(), vector, mbssync.DefaultCollection, storage.SearchOptions{
+		Limit:          uint64(request.TopK),
+		ScoreThreshold: request.ScoreThreshold,
+		Filter:         request.Filter,
+	})
+	if err != nil {
+		log.Printf("Search failed: %v", err)
+		http.Error(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Results []storage.SearchResult `json:"results"`
+	}{
+		Results: results,
+	})
+}
+
+// runSearchCLI runs the search subcommand. Query words and flags may be mixed
+// in any order; everything after "--" is part of the query.
+func runSearchCLI(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	topK := fs.Int("k", defaultTopK, "Number of results")
+	threshold := fs.Float64("threshold", 0, "Minimum score, 0 for none")
+	format := fs.String("format", "table", "Output format: table, json or csv")
+	category := fs.String("category", "", "Comma-separated categories")
+	group := fs.String("group", "", "Comma-separated groups")
+	subGroup := fs.String("sub-group", "", "Comma-separated sub-groups")
+	itemType := fs.String("item-type", "", "Comma-separated item types")
+	providerType := fs.String("provider-type", "", "Comma-separated provider types")
+	var filter storage.Filter
+	bounds := rangeFlags(fs, &filter)
+	activeOn := fs.String("active-on", "", "Only items active on this date (DD.MM.YYYY or YYYY-MM-DD)")
+
+	// flag stops at the first query word, so parse again after each one
+	var query []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			query = append(query, rest...)
+			break
+		}
+		query = append(query, rest[0])
+		args = rest[1:]
+	}
+
+	text := strings.TrimSpace(strings.Join(query, " "))
+	if text == "" {
+		log.Fatal(`Usage: mbsoeg search "query" [-k 10] [--category 3] [--format table|json|csv]`)
+	}
+	if *topK < 1 || *topK > maxTopK {
+		log.Fatalf("-k must be between 1 and %d", maxTopK)
+	}
+
+	filter.Category = splitList(*category)
+	filter.Group = splitList(*group)
+	filter.SubGroup = splitList(*subGroup)
+	filter.ItemType = splitList(*itemType)
+	filter.ProviderType = splitList(*providerType)
+	filter.ActiveOn = *activeOn
+	bounds.apply()
+	if err := filter.Validate(); err != nil {
+		log.Fatalf("Invalid filter: %v", err)
+	}
+
+	opts := storage.SearchOptions{Limit: uint64(*topK), Filter: filter}
+	if *threshold > 0 {
+		score := float32(*threshold)
+		opts.ScoreThreshold = &score
+	}
+
+	cfg := loadConfig()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Search runs alongside the server, so it leaves the embedding cache file,
+	// which only one process can open, to the server. The provider is not
+	// validated separately; a bad configuration fails the query itself.
+	embeddingsCfg := embeddingsConfig(cfg)
+	embeddingsCfg.CachePath = ""
+	embeddingsSvc, err := embeddings.NewService(embeddingsCfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize embeddings service: %v", err)
+	}
+
+	storageSvc, err := storage.NewService(cfg.QdrantHost, cfg.QdrantPort, cfg.QdrantTimeout)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage service: %v", err)
+	}
+
+	vector, err := embeddingsSvc.EmbedQuery(ctx, text)
+	if err != nil {
+		log.Fatalf("Failed to embed search text: %v", err)
+	}
+
+	results, err := storageSvc.Search(ctx, vector, mbssync.DefaultCollection, opts)
+	if err != nil {
+		log.Fatalf("Search failed: %v", err)
+	}
+
+	if err := writeResults(os.Stdout, results, *format); err != nil {
+		log.Fatalf("Failed to write results: %v", err)
+	}
+}
+
+// rangeFilter holds the bounds set by the --min-* and --max-* flags for one
+// numeric field, until they are applied to the filter
+type rangeFilter struct {
+	field  storage.RangeField
+	bounds storage.Range
+}
+
+// rangeFilters is the set of range flags registered on a flag set
+type rangeFilters []*rangeFilter
+
+// rangeFlags registers --min-<field> and --max-<field> for every numeric
+// field the filter supports, such as --min-benefit-75, with --min-fee and
+// --max-fee kept as short names for the schedule fee
+func rangeFlags(fs *flag.FlagSet, filter *storage.Filter) rangeFilters {
+	var filters rangeFilters
+	for _, field := range filter.RangeFields() {
+		rf := &rangeFilter{field: field}
+		name := strings.ReplaceAll(field.Key, "_", "-")
+		label := strings.ReplaceAll(field.Key, "_", " ")
+		fs.Var(floatFlag{&rf.bounds.GTE}, "min-"+name, "Minimum "+label)
+		fs.Var(floatFlag{&rf.bounds.LTE}, "max-"+name, "Maximum "+label)
+		if field.Key == "schedule_fee" {
+			fs.Var(floatFlag{&rf.bounds.GTE}, "min-fee", "Minimum schedule fee")
+			fs.Var(floatFlag{&rf.bounds.LTE}, "max-fee", "Maximum schedule fee")
+		}
+		filters = append(filters, rf)
+	}
+	return filters
+}
+
+// apply sets the filter's range for each field with a bound
+func (filters rangeFilters) apply() {
+	for _, rf := range filters {
+		if rf.bounds.GTE != nil || rf.bounds.LTE != nil {
+			bounds := rf.bounds
+			*rf.field.Range = &bounds
+		}
+	}
+}
+
+// floatFlag is an optional float flag that stays nil until set
+type floatFlag struct {
+	value **float64
+}
+
+func (f floatFlag) String() string {
+	if f.value == nil || *f.value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(**f.value, 'f', -1, 64)
+}
+
+func (f floatFlag) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*f.value = &v
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) storage.StringList {
+	var list storage.StringList
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// writeResults prints search results as a table, JSON or CSV
+func writeResults(w io.Writer, results []storage.SearchResult, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"item_num", "score", "schedule_fee", "description"})
+		for _, result := range results {
+			cw.Write([]string{
+				result.Item.ItemNum,
+				strconv.FormatFloat(float64(result.Score), 'f', 4, 32),
+				strconv.FormatFloat(result.Item.ScheduleFee, 'f', 2, 64),
+				result.Item.Description,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ITEM\tSCORE\tFEE\tDESCRIPTION")
+		for _, result := range results {
+			fmt.Fprintf(tw, "%s\t%.4f\t%.2f\t%s\n", result.Item.ItemNum, result.Score, result.Item.ScheduleFee, truncate(result.Item.Description, 80))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
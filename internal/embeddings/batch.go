@@ -0,0 +1,77 @@
+package embeddings
+
+import (
+	"context"
+
+	"mbsoeg/pkg/models"
+)
+
+const (
+	// DefaultBatchSize is the default maximum number of inputs per request
+	DefaultBatchSize = 100
+	// DefaultBatchTokens is the default maximum estimated tokens per request
+	DefaultBatchTokens = 50000
+)
+
+// EstimateTokens gives a rough token count for text, at about four characters per token
+func EstimateTokens(text string) int {
+	return len(text)/4 + 1
+}
+
+// BatchJobs groups jobs so each batch holds at most maxItems jobs and
+// maxTokens estimated tokens. A single job over the token budget is sent alone.
+func BatchJobs(jobs []models.EmbeddingJob, maxItems, maxTokens int) [][]models.EmbeddingJob {
+	if maxItems <= 0 {
+		maxItems = DefaultBatchSize
+	}
+	if maxTokens <= 0 {
+		maxTokens = DefaultBatchTokens
+	}
+
+	var batches [][]models.EmbeddingJob
+	var current []models.EmbeddingJob
+	var currentTokens int
+
+	for _, job := range jobs {
+		tokens := EstimateTokens(job.Text)
+		if len(current) > 0 && (len(current) >= maxItems || currentTokens+tokens > maxTokens) {
+			batches = append(batches, current)
+			current = nil
+			currentTokens = 0
+		}
+		current = append(current, job)
+		currentTokens += tokens
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+
+	return batches
+}
+
+// EmbedJobs embeds a batch of jobs in one provider call and maps the returned
+// vectors back to their jobs by index. If the call fails every result carries the error.
+func (s *Service) EmbedJobs(ctx context.Context, jobs []models.EmbeddingJob) []models.EmbeddingResult {
+	texts := make([]string, len(jobs))
+	for i, job := range jobs {
+		texts[i] = job.Text
+	}
+
+	vectors, err := s.GetEmbeddings(ctx, texts)
+
+	results := make([]models.EmbeddingResult, len(jobs))
+	for i, job := range jobs {
+		results[i] = models.EmbeddingResult{
+			ItemNum:     job.ItemNum,
+			Item:        job.Item,
+			NewHash:     job.NewHash,
+			ContentHash: job.ContentHash,
+			Error:       err,
+		}
+		if err == nil {
+			results[i].Vector = vectors[i]
+		}
+	}
+
+	return results
+}
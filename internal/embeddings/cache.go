@@ -0,0 +1,113 @@
+package embeddings
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var cacheBucket = []byte("embeddings")
+
+// Cache is a persistent local store of embeddings, keyed by model ID, vector
+// dimension and a hash of the exact input text, so unchanged text is never
+// embedded twice
+type Cache struct {
+	db *bolt.DB
+}
+
+// OpenCache opens or creates the cache file at path
+func OpenCache(path string) (*Cache, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %v", err)
+		}
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedding cache %s: %v", path, err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(cacheBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize embedding cache: %v", err)
+	}
+
+	return &Cache{db: db}, nil
+}
+
+// Get returns the cached embeddings for texts. Missing entries are nil, as are
+// entries whose length does not match dimension when dimension is known.
+func (c *Cache) Get(modelID string, dimension int, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(cacheBucket)
+		for i, text := range texts {
+			value := bucket.Get(cacheKey(modelID, dimension, text))
+			if value == nil || (dimension > 0 && len(value) != 4*dimension) {
+				continue
+			}
+			vectors[i] = decodeVector(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding cache: %v", err)
+	}
+	return vectors, nil
+}
+
+// Put stores embeddings for texts in a single transaction
+func (c *Cache) Put(modelID string, dimension int, texts []string, vectors [][]float32) error {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(cacheBucket)
+		for i, text := range texts {
+			if err := bucket.Put(cacheKey(modelID, dimension, text), encodeVector(vectors[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write embedding cache: %v", err)
+	}
+	return nil
+}
+
+// Close releases the cache file
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+// cacheKey hashes the model ID, vector dimension and exact input text. The
+// dimension is part of the key because text-embedding-3 models return
+// different vectors for the same model ID when the output is reduced.
+func cacheKey(modelID string, dimension int, text string) []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s", modelID, dimension, text)))
+	return sum[:]
+}
+
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return vector
+}
@@ -0,0 +1,72 @@
+package embeddings
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"math/rand"
+)
+
+const defaultFakeDimension = 1536
+
+// fakeEmbedder derives a deterministic unit vector from a hash of the text.
+// It makes no network calls and is intended for local development and tests.
+type fakeEmbedder struct {
+	dimension int
+}
+
+func newFakeEmbedder(cfg Config) *fakeEmbedder {
+	dimension := cfg.Dimension
+	if dimension == 0 {
+		dimension = defaultFakeDimension
+	}
+	return &fakeEmbedder{dimension: dimension}
+}
+
+// Embed generates an embedding for the given text
+func (e *fakeEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(text))
+	rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+
+	vector := make([]float32, e.dimension)
+	var norm float64
+	for i := range vector {
+		v := rng.NormFloat64()
+		vector[i] = float32(v)
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+
+	return vector, nil
+}
+
+// EmbedBatch generates embeddings for the given texts, in input order
+func (e *fakeEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector, err := e.Embed(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// Dimension returns the configured vector size
+func (e *fakeEmbedder) Dimension() int {
+	return e.dimension
+}
+
+// ModelID returns the provider and model identifier
+func (e *fakeEmbedder) ModelID() string {
+	return "fake/sha256"
+}
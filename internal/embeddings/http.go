@@ -0,0 +1,146 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout bounds a single attempt of an embeddings request
+const DefaultTimeout = 60 * time.Second
+
+// sharedClient is reused by every provider so connections are pooled across workers
+var sharedClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
+// requester sends JSON requests to a provider, retrying transient failures.
+// Every attempt first waits on the shared rate limiter.
+type requester struct {
+	client  *http.Client
+	retry   RetryPolicy
+	limiter *Limiter
+	timeout time.Duration
+}
+
+// postJSON sends payload as a JSON POST request and decodes the JSON response into out.
+// tokens is the estimated token count of the request, used for rate limiting.
+func (r *requester) postJSON(ctx context.Context, url string, headers map[string]string, payload interface{}, tokens int, out interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	maxAttempts := r.retry.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := r.limiter.Wait(ctx, tokens); err != nil {
+			return err
+		}
+
+		body, err := r.do(ctx, url, headers, jsonData)
+		if err == nil {
+			if err := json.Unmarshal(body, out); err != nil {
+				return fmt.Errorf("failed to parse response: %v", err)
+			}
+			return nil
+		}
+
+		// The caller gave up, so there is nothing to retry
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !isRetryable(err) {
+			return err
+		}
+		if attempt >= maxAttempts {
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+
+		// A wait requested by the provider applies to the whole budget, so it
+		// pauses every worker through the shared limiter
+		delay, requested := r.retry.backoff(attempt, err)
+		log.Printf("Embedding request failed (attempt %d/%d), retrying in %s: %v", attempt, maxAttempts, delay.Round(time.Millisecond), err)
+		if requested {
+			r.limiter.Pause(delay)
+			continue
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// do sends a single request and returns the response body of a 200 response
+func (r *requester) do(ctx context.Context, url string, headers map[string]string, jsonData []byte) ([]byte, error) {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, &transportError{err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &transportError{err: fmt.Errorf("failed to read response body: %v", err)}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			RetryAfter: retryAfter(resp.Header),
+		}
+	}
+
+	return body, nil
+}
+
+// sleep waits for d, returning early with the context error if ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+package embeddings
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit holds per-minute request and token budgets. Zero means unlimited.
+type RateLimit struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+}
+
+// defaultRateLimits are conservative budgets for known models, keyed by model ID
+var defaultRateLimits = map[string]RateLimit{
+	"openai/text-embedding-ada-002": {RequestsPerMinute: 3000, TokensPerMinute: 1000000},
+	"openai/text-embedding-3-small": {RequestsPerMinute: 3000, TokensPerMinute: 1000000},
+	"openai/text-embedding-3-large": {RequestsPerMinute: 3000, TokensPerMinute: 1000000},
+}
+
+// DefaultRateLimit returns the budget used for a model ID when none is configured
+func DefaultRateLimit(modelID string) RateLimit {
+	return defaultRateLimits[modelID]
+}
+
+// Limiter is a token bucket shared by every worker calling a provider. Each
+// budget refills continuously over a minute, and zero budgets are unlimited.
+// A pause requested by the provider holds back every worker until it ends.
+type Limiter struct {
+	mu          sync.Mutex
+	limit       RateLimit
+	requests    float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+// NewLimiter creates a limiter that starts with full budgets
+func NewLimiter(limit RateLimit) *Limiter {
+	return &Limiter{
+		limit:    limit,
+		requests: float64(limit.RequestsPerMinute),
+		tokens:   float64(limit.TokensPerMinute),
+		last:     time.Now(),
+	}
+}
+
+// Wait blocks until one request carrying the given number of tokens fits both
+// budgets, or until ctx is done
+func (l *Limiter) Wait(ctx context.Context, tokens int) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	for {
+		delay := l.reserve(tokens)
+		if delay == 0 {
+			return nil
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Pause holds back every request until d has passed, extending any pause
+// already in place
+func (l *Limiter) Pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// reserve takes from the budgets if possible, otherwise returns how long to wait
+func (l *Limiter) reserve(tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(l.last).Minutes()
+	l.last = now
+
+	rpm := float64(l.limit.RequestsPerMinute)
+	tpm := float64(l.limit.TokensPerMinute)
+	need := float64(tokens)
+	if need > tpm {
+		// A request larger than the whole budget waits for a full bucket
+		need = tpm
+	}
+
+	var wait float64
+	if rpm > 0 {
+		l.requests = min(rpm, l.requests+elapsed*rpm)
+		if l.requests < 1 {
+			wait = max(wait, (1-l.requests)/rpm)
+		}
+	}
+	if tpm > 0 {
+		l.tokens = min(tpm, l.tokens+elapsed*tpm)
+		if l.tokens < need {
+			wait = max(wait, (need-l.tokens)/tpm)
+		}
+	}
+
+	if pause := l.pausedUntil.Sub(now); pause > 0 {
+		return max(pause, time.Duration(wait*float64(time.Minute)))
+	}
+	if wait > 0 {
+		return time.Duration(wait * float64(time.Minute))
+	}
+
+	if rpm > 0 {
+		l.requests--
+	}
+	if tpm > 0 {
+		l.tokens -= need
+	}
+	return 0
+}
@@ -0,0 +1,84 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultOllamaBaseURL = "http://localhost:11434"
+	defaultOllamaModel   = "nomic-embed-text"
+)
+
+type ollamaRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+type ollamaResponse struct {
+	Embedding []float32 `json:"embedding"`
+}
+
+// ollamaEmbedder calls an Ollama-style local embeddings server
+type ollamaEmbedder struct {
+	client    *requester
+	url       string
+	model     string
+	dimension int
+}
+
+func newOllamaEmbedder(cfg Config, client *requester) *ollamaEmbedder {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	model := cfg.Model
+	if model == "" {
+		model = defaultOllamaModel
+	}
+
+	return &ollamaEmbedder{
+		client:    client,
+		url:       strings.TrimSuffix(baseURL, "/") + "/api/embeddings",
+		model:     model,
+		dimension: cfg.Dimension,
+	}
+}
+
+// Embed generates an embedding for the given text
+func (e *ollamaEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	var resp ollamaResponse
+	if err := e.client.postJSON(ctx, e.url, nil, ollamaRequest{Model: e.model, Prompt: text}, EstimateTokens(text), &resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Embedding) == 0 {
+		return nil, fmt.Errorf("no embedding data in response")
+	}
+
+	return resp.Embedding, nil
+}
+
+// EmbedBatch embeds each text in turn, as the endpoint takes a single prompt
+func (e *ollamaEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector, err := e.Embed(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// Dimension returns the configured vector size
+func (e *ollamaEmbedder) Dimension() int {
+	return e.dimension
+}
+
+// ModelID returns the provider and model identifier
+func (e *ollamaEmbedder) ModelID() string {
+	return "ollama/" + e.model
+}
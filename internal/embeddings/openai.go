@@ -0,0 +1,170 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+	defaultOpenAIModel   = "text-embedding-ada-002"
+)
+
+// openAIDimensions lists the native vector size of known OpenAI models
+var openAIDimensions = map[string]int{
+	"text-embedding-ada-002": 1536,
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+}
+
+type OpenAIRequest struct {
+	Input      []string `json:"input"`
+	Model      string   `json:"model,omitempty"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type OpenAIResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// openAIEmbedder calls the OpenAI embeddings API, or an Azure OpenAI deployment
+type openAIEmbedder struct {
+	client    *requester
+	url       string
+	headers   map[string]string
+	model     string
+	provider  string
+	dimension int
+	reduced   int // dimensions parameter sent to the API, 0 for the native size
+}
+
+// resolveDimension returns the vector size for model and the reduced size to
+// request from the API. Only text-embedding-3 models accept a reduced size.
+func resolveDimension(model string, configured int) (dimension, reduced int, err error) {
+	native := openAIDimensions[model]
+	if configured == 0 || configured == native {
+		return native, 0, nil
+	}
+	if native == 0 {
+		// Unknown model or Azure deployment name, trust the configured size
+		return configured, 0, nil
+	}
+	if !strings.HasPrefix(model, "text-embedding-3") {
+		return 0, 0, fmt.Errorf("model %s produces %d-dimensional vectors and does not support a reduced dimension of %d", model, native, configured)
+	}
+	if configured < 0 || configured > native {
+		return 0, 0, fmt.Errorf("dimension %d is out of range for model %s (1-%d)", configured, model, native)
+	}
+	return configured, configured, nil
+}
+
+func newOpenAIEmbedder(cfg Config, client *requester) (*openAIEmbedder, error) {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	model := cfg.Model
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+	dimension, reduced, err := resolveDimension(model, cfg.Dimension)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openAIEmbedder{
+		client:    client,
+		url:       strings.TrimSuffix(baseURL, "/") + "/embeddings",
+		headers:   map[string]string{"Authorization": "Bearer " + cfg.APIKey},
+		model:     model,
+		provider:  "openai",
+		dimension: dimension,
+		reduced:   reduced,
+	}, nil
+}
+
+func newAzureEmbedder(cfg Config, client *requester) (*openAIEmbedder, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("azure embedding provider requires a base URL")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("azure embedding provider requires a deployment name as the model")
+	}
+	apiVersion := cfg.APIVersion
+	if apiVersion == "" {
+		apiVersion = "2024-02-01"
+	}
+	dimension, reduced, err := resolveDimension(cfg.Model, cfg.Dimension)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openAIEmbedder{
+		client: client,
+		url: fmt.Sprintf("%s/openai/deployments/%s/embeddings?api-version=%s",
+			strings.TrimSuffix(cfg.BaseURL, "/"), cfg.Model, apiVersion),
+		headers:   map[string]string{"api-key": cfg.APIKey},
+		model:     cfg.Model,
+		provider:  "azure",
+		dimension: dimension,
+		reduced:   reduced,
+	}, nil
+}
+
+// Embed generates an embedding for the given text
+func (e *openAIEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := e.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// EmbedBatch sends all texts in a single request and orders the vectors by index
+func (e *openAIEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	payload := OpenAIRequest{Input: texts, Dimensions: e.reduced}
+	if e.provider == "openai" {
+		payload.Model = e.model
+	}
+
+	tokens := 0
+	for _, text := range texts {
+		tokens += EstimateTokens(text)
+	}
+
+	var openAIResp OpenAIResponse
+	if err := e.client.postJSON(ctx, e.url, e.headers, payload, tokens, &openAIResp); err != nil {
+		return nil, err
+	}
+
+	if len(openAIResp.Data) == 0 {
+		return nil, fmt.Errorf("no embedding data in response")
+	}
+	if len(openAIResp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings in response, got %d", len(texts), len(openAIResp.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, data := range openAIResp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+		}
+		vectors[data.Index] = data.Embedding
+	}
+
+	return vectors, nil
+}
+
+// Dimension returns the vector size of the configured model
+func (e *openAIEmbedder) Dimension() int {
+	return e.dimension
+}
+
+// ModelID returns the provider and model identifier
+func (e *openAIEmbedder) ModelID() string {
+	return e.provider + "/" + e.model
+}
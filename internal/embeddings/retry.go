@@ -0,0 +1,141 @@
+package embeddings
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how failed embedding requests are retried
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts, including the first
+	BaseDelay   time.Duration // delay before the first retry
+	MaxDelay    time.Duration // upper bound for the exponential backoff
+	MaxWait     time.Duration // upper bound for a wait requested by the provider
+}
+
+// DefaultMaxRetryWait is the longest provider-requested wait honoured when none is configured
+const DefaultMaxRetryWait = 5 * time.Minute
+
+// DefaultRetryPolicy returns the retry policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		MaxWait:     DefaultMaxRetryWait,
+	}
+}
+
+// APIError is returned when the provider answers with a non-200 status
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // wait requested by the provider, if any
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the request may succeed if sent again
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// RetryError is the terminal error returned once all attempts have failed
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("giving up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// transportError marks a failure to reach the provider, which is always retried
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return fmt.Sprintf("failed to make request: %v", e.err)
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable reports whether err is worth another attempt
+func isRetryable(err error) bool {
+	switch e := err.(type) {
+	case *APIError:
+		return e.Retryable()
+	case *transportError:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff returns how long to wait before the given retry (1-based). A wait
+// requested by the provider takes precedence over exponential backoff with
+// jitter; it is capped at MaxWait and reported with requested set, so the
+// caller can pause every worker rather than just this one.
+func (p RetryPolicy) backoff(retry int, err error) (delay time.Duration, requested bool) {
+	if apiErr, ok := err.(*APIError); ok && apiErr.RetryAfter > 0 {
+		if p.MaxWait > 0 && apiErr.RetryAfter > p.MaxWait {
+			return p.MaxWait, true
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	delay = p.BaseDelay << uint(retry-1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// Full jitter over the upper half of the window
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), false
+}
+
+// retryAfter extracts the wait requested by the provider from response headers
+func retryAfter(header http.Header) time.Duration {
+	if ms := header.Get("retry-after-ms"); ms != "" {
+		if v, err := strconv.ParseFloat(ms, 64); err == nil && v > 0 {
+			return time.Duration(v * float64(time.Millisecond))
+		}
+	}
+
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			if wait := time.Until(date); wait > 0 {
+				return wait
+			}
+		}
+	}
+
+	// OpenAI reports when each exhausted budget resets, e.g. "1s" or "6m0s"
+	var wait time.Duration
+	for _, budget := range []string{"requests", "tokens"} {
+		if header.Get("x-ratelimit-remaining-"+budget) != "0" {
+			continue
+		}
+		if reset, err := time.ParseDuration(strings.TrimSpace(header.Get("x-ratelimit-reset-" + budget))); err == nil && reset > wait {
+			wait = reset
+		}
+	}
+
+	return wait
+}
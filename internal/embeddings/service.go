@@ -1,84 +1,197 @@
 package embeddings
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
+	"log"
+	"strings"
+	"time"
 )
 
-type OpenAIRequest struct {
-	Input string `json:"input"`
-	Model string `json:"model"`
+// Embedder is implemented by every embedding provider
+type Embedder interface {
+	// Embed generates an embedding for a single text
+	Embed(ctx context.Context, text string) ([]float32, error)
+	// EmbedBatch generates embeddings for several texts, in input order
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+	// Dimension returns the length of the vectors produced, or 0 if unknown
+	Dimension() int
+	// ModelID identifies the provider and model that produced the vectors
+	ModelID() string
 }
 
-type OpenAIResponse struct {
-	Data []struct {
-		Embedding []float32 `json:"embedding"`
-	} `json:"data"`
+// Config selects and configures an embedding provider
+type Config struct {
+	Provider   string // openai, azure, ollama or fake
+	Model      string // model name, or deployment name for Azure
+	APIKey     string
+	BaseURL    string
+	APIVersion string // Azure only
+	Dimension  int    // vector size; reduces text-embedding-3 output, required when the model is not known
+
+	MaxAttempts  int           // attempts per request before giving up, 0 for the default
+	MaxRetryWait time.Duration // longest provider-requested wait honoured, 0 for the default
+	Timeout      time.Duration // per-attempt request timeout, 0 for the default
+
+	// RateLimit overrides the default budgets for the model when either value is set
+	RateLimit RateLimit
+
+	CachePath string // local embedding cache file, empty to disable caching
 }
 
-// Service handles interactions with the OpenAI embeddings API
+// Service handles interactions with the configured embeddings provider
 type Service struct {
-	apiKey string
+	embedder Embedder
+	cache    *Cache
 }
 
-// NewService creates a new embeddings service
-func NewService(apiKey string) *Service {
-	return &Service{
-		apiKey: apiKey,
+// NewService creates a new embeddings service for the configured provider
+func NewService(cfg Config) (*Service, error) {
+	embedder, err := NewEmbedder(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &Service{embedder: embedder}
+	if cfg.CachePath != "" {
+		if svc.cache, err = OpenCache(cfg.CachePath); err != nil {
+			return nil, err
+		}
 	}
+
+	return svc, nil
 }
 
-// GetEmbedding generates an embedding for the given text
-func (s *Service) GetEmbedding(text string) ([]float32, error) {
-	apiURL := "https://api.openai.com/v1/embeddings"
-	payload := OpenAIRequest{Input: text, Model: "text-embedding-ada-002"}
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %v", err)
+// Close releases the embedding cache, if any
+func (s *Service) Close() error {
+	if s.cache == nil {
+		return nil
 	}
+	return s.cache.Close()
+}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+// NewEmbedder creates the provider selected by cfg.Provider
+func NewEmbedder(cfg Config) (Embedder, error) {
+	if cfg.Dimension < 0 {
+		return nil, fmt.Errorf("invalid embedding dimension %d, expected 0 for the model default or a positive size", cfg.Dimension)
+	}
+
+	retry := DefaultRetryPolicy()
+	if cfg.MaxAttempts > 0 {
+		retry.MaxAttempts = cfg.MaxAttempts
 	}
+	if cfg.MaxRetryWait > 0 {
+		retry.MaxWait = cfg.MaxRetryWait
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client := &requester{client: sharedClient, retry: retry, timeout: timeout}
 
-	req.Header.Set("Authorization", "Bearer "+s.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	var embedder Embedder
+	switch strings.ToLower(cfg.Provider) {
+	case "", "openai":
+		openAI, err := newOpenAIEmbedder(cfg, client)
+		if err != nil {
+			return nil, err
+		}
+		embedder = openAI
+	case "azure":
+		azure, err := newAzureEmbedder(cfg, client)
+		if err != nil {
+			return nil, err
+		}
+		embedder = azure
+	case "ollama":
+		embedder = newOllamaEmbedder(cfg, client)
+	case "fake":
+		return newFakeEmbedder(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider: %s", cfg.Provider)
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// One limiter per provider, shared by every worker using this embedder.
+	// It is created even without budgets so provider-requested waits pause
+	// every worker.
+	limit := cfg.RateLimit
+	if limit.RequestsPerMinute == 0 && limit.TokensPerMinute == 0 {
+		limit = DefaultRateLimit(embedder.ModelID())
+	}
+	client.limiter = NewLimiter(limit)
+
+	return embedder, nil
+}
+
+// GetEmbedding generates an embedding for the given text, using the cache when possible
+func (s *Service) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := s.GetEmbeddings(ctx, []string{text})
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return vectors[0], nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+// EmbedQuery generates an embedding for ad-hoc query text. It bypasses the
+// cache, which holds item texts and would otherwise grow with every search.
+func (s *Service) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	return s.embedder.Embed(ctx, text)
+}
+
+// GetEmbeddings generates embeddings for the given texts, in input order. Cached
+// texts are served locally and only the remainder is sent to the provider.
+func (s *Service) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	if s.cache == nil {
+		return s.embedder.EmbedBatch(ctx, texts)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	modelID, dimension := s.embedder.ModelID(), s.embedder.Dimension()
+	vectors, err := s.cache.Get(modelID, dimension, texts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+		log.Printf("Warning: %v", err)
+		vectors = make([][]float32, len(texts))
 	}
 
-	var openAIResp OpenAIResponse
-	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+	var missing []string
+	var missingIdx []int
+	for i, vector := range vectors {
+		if vector == nil {
+			missing = append(missing, texts[i])
+			missingIdx = append(missingIdx, i)
+		}
+	}
+	if len(missing) == 0 {
+		return vectors, nil
 	}
 
-	if len(openAIResp.Data) == 0 {
-		return nil, fmt.Errorf("no embedding data in response")
+	embedded, err := s.embedder.EmbedBatch(ctx, missing)
+	if err != nil {
+		return nil, err
 	}
+	for j, i := range missingIdx {
+		vectors[i] = embedded[j]
+	}
+
+	if err := s.cache.Put(modelID, dimension, missing, embedded); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	return vectors, nil
+}
+
+// Dimension returns the vector size produced by the provider
+func (s *Service) Dimension() int {
+	return s.embedder.Dimension()
+}
 
-	return openAIResp.Data[0].Embedding, nil
+// ModelID returns the provider and model identifier
+func (s *Service) ModelID() string {
+	return s.embedder.ModelID()
 }
 
-// ValidateAPIKey checks if the API key is valid by making a test request
-func (s *Service) ValidateAPIKey() error {
-	_, err := s.GetEmbedding("test")
+// ValidateAPIKey checks if the API key is valid by making a test request,
+// bypassing the cache
+func (s *Service) ValidateAPIKey(ctx context.Context) error {
+	_, err := s.embedder.Embed(ctx, "test")
 	return err
 }
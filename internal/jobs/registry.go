@@ -0,0 +1,430 @@
+// Package jobs runs sync requests in the background, one at a time, and keeps
+// their state and history for status polling.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mbssync "mbsoeg/internal/sync"
+	"mbsoeg/pkg/models"
+)
+
+// DefaultHistory is the number of finished jobs kept when none is configured
+const DefaultHistory = 50
+
+// State is the lifecycle state of a job
+type State string
+
+// Job states
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Finished reports whether the job has stopped
+func (s State) Finished() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCancelled
+}
+
+// Runner runs a sync, reporting progress to observers
+type Runner interface {
+	Run(ctx context.Context, items []models.MBSItem, opts mbssync.RunOptions, observers ...mbssync.Observer) (*mbssync.Report, error)
+}
+
+// Job is a snapshot of a sync job
+type Job struct {
+	ID         string             `json:"id"`
+	State      State              `json:"state"`
+	Items      int                `json:"items"`
+	Options    mbssync.RunOptions `json:"options"`
+	CreatedAt  time.Time          `json:"created_at"`
+	StartedAt  *time.Time         `json:"started_at,omitempty"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+	Report     *mbssync.Report    `json:"report,omitempty"`
+	Phases     []PhaseChange      `json:"phases,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// PhaseChange records when a job entered a sync phase
+type PhaseChange struct {
+	Phase mbssync.Phase `json:"phase"`
+	At    time.Time     `json:"at"`
+}
+
+// job is a registered job. Its snapshot, cancel function and subscribers are
+// guarded by the registry mutex.
+type job struct {
+	registry    *Registry
+	snapshot    Job
+	items       []models.MBSItem
+	cancel      context.CancelFunc // stops the job once it is running
+	subscribers map[chan struct{}]bool
+}
+
+// Progress records the counts so far, logs any phase change and signals
+// subscribers. Every phase change is kept, so subscribers that are signalled
+// once for several changes still see each phase.
+func (j *job) Progress(report mbssync.Report) {
+	j.registry.mu.Lock()
+	defer j.registry.mu.Unlock()
+	j.snapshot.Report = &report
+	phases := j.snapshot.Phases
+	if report.Phase != "" && (len(phases) == 0 || phases[len(phases)-1].Phase != report.Phase) {
+		j.snapshot.Phases = append(phases, PhaseChange{Phase: report.Phase, At: time.Now()})
+	}
+	j.signal()
+}
+
+// signal tells each subscriber the snapshot changed, without blocking. A
+// subscriber that has not caught up yet gets one signal for several changes.
+func (j *job) signal() {
+	for ch := range j.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Policy decides what happens to a job submitted while another is queued or running
+type Policy string
+
+// Concurrency policies
+const (
+	PolicyReject   Policy = "reject"   // refuse the new job with ErrBusy
+	PolicyQueue    Policy = "queue"    // run jobs one at a time in submission order
+	PolicyCoalesce Policy = "coalesce" // replace any waiting job with the new one
+)
+
+// ParsePolicy converts a policy name to a Policy, defaulting to PolicyQueue
+func ParsePolicy(name string) (Policy, error) {
+	switch policy := Policy(strings.ToLower(name)); policy {
+	case "":
+		return PolicyQueue, nil
+	case PolicyReject, PolicyQueue, PolicyCoalesce:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown concurrency policy: %s", name)
+	}
+}
+
+// BusyError is returned by Submit under PolicyReject while a job is active
+type BusyError struct {
+	JobID string // the running job
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("sync job %s is already in progress", e.JobID)
+}
+
+// Errors returned by Cancel
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job has already finished")
+)
+
+// Registry runs jobs in the background one at a time, applying its policy to
+// jobs submitted meanwhile, and keeps the most recent finished ones
+type Registry struct {
+	runner  Runner
+	ctx     context.Context
+	history int
+	policy  Policy
+
+	wg sync.WaitGroup // running jobs
+
+	mu         sync.Mutex
+	jobs       map[string]*job
+	queue      []*job   // jobs waiting to run, oldest first
+	running    *job     // the job being run, if any
+	finished   []string // IDs of finished jobs, oldest first
+	lastSubmit time.Time
+}
+
+// NewRegistry creates a registry that runs jobs with runner until ctx is
+// cancelled, keeping up to history finished jobs. Cancelling ctx stops the
+// running job and cancels the queued ones.
+func NewRegistry(ctx context.Context, runner Runner, history int, policy Policy) *Registry {
+	if history < 1 {
+		history = DefaultHistory
+	}
+	if policy == "" {
+		policy = PolicyQueue
+	}
+	return &Registry{
+		runner:  runner,
+		ctx:     ctx,
+		history: history,
+		policy:  policy,
+		jobs:    make(map[string]*job),
+	}
+}
+
+// Submit adds a sync of items and returns its job. Under PolicyReject it
+// returns a *BusyError if a job is already active.
+func (r *Registry) Submit(items []models.MBSItem, opts mbssync.RunOptions) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.policy == PolicyReject && r.running != nil {
+		return Job{}, &BusyError{JobID: r.running.snapshot.ID}
+	}
+
+	j := &job{
+		registry: r,
+		items:    items,
+		snapshot: Job{ID: id, State: StateQueued, Items: len(items), Options: opts, CreatedAt: time.Now()},
+	}
+
+	if r.policy == PolicyCoalesce {
+		for _, waiting := range r.queue {
+			log.Printf("Job %s superseded by job %s", waiting.snapshot.ID, id)
+			r.drop(waiting, fmt.Sprintf("superseded by job %s", id))
+		}
+		r.queue = nil
+	}
+
+	r.jobs[id] = j
+	r.queue = append(r.queue, j)
+	r.lastSubmit = j.snapshot.CreatedAt
+	r.dispatch()
+	return j.snapshot, nil
+}
+
+// dispatch starts the next queued job if none is running, or cancels the
+// queued jobs once the registry is shutting down. It is called with the mutex
+// held.
+func (r *Registry) dispatch() {
+	if r.ctx.Err() != nil {
+		for _, waiting := range r.queue {
+			r.drop(waiting, "server shutting down")
+		}
+		r.queue = nil
+		return
+	}
+	if r.running != nil || len(r.queue) == 0 {
+		return
+	}
+	j := r.queue[0]
+	r.queue = r.queue[1:]
+	r.running = j
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	j.cancel = cancel
+	started := time.Now()
+	j.snapshot.State = StateRunning
+	j.snapshot.StartedAt = &started
+	j.signal()
+	r.wg.Add(1)
+	go r.run(ctx, j)
+}
+
+// run runs a job, records its outcome and starts the next one
+func (r *Registry) run(ctx context.Context, j *job) {
+	defer r.wg.Done()
+	id := j.snapshot.ID
+	log.Printf("Job %s started with %d items", id, len(j.items))
+	report, err := r.runner.Run(ctx, j.items, j.snapshot.Options, j)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j.cancel()
+	finished := time.Now()
+	j.snapshot.FinishedAt = &finished
+	j.snapshot.Report = report
+	switch {
+	case err == nil:
+		j.snapshot.State = StateSucceeded
+	case ctx.Err() != nil || errors.Is(err, context.Canceled) || (report != nil && report.Cancelled):
+		j.snapshot.State = StateCancelled
+		j.snapshot.Error = err.Error()
+	default:
+		j.snapshot.State = StateFailed
+		j.snapshot.Error = err.Error()
+	}
+	log.Printf("Job %s %s after %s", id, j.snapshot.State, finished.Sub(*j.snapshot.StartedAt).Round(time.Millisecond))
+
+	r.running = nil
+	r.finish(j)
+	r.dispatch()
+}
+
+// drop cancels a job that never started. It is called with the mutex held.
+func (r *Registry) drop(j *job, reason string) {
+	now := time.Now()
+	j.snapshot.State = StateCancelled
+	j.snapshot.FinishedAt = &now
+	j.snapshot.Error = reason
+	r.finish(j)
+}
+
+// finish closes a finished job's subscriptions and moves it to the history,
+// dropping the oldest finished jobs. It is called with the mutex held.
+func (r *Registry) finish(j *job) {
+	j.items = nil
+	for ch := range j.subscribers {
+		close(ch)
+	}
+	j.subscribers = nil
+
+	r.finished = append(r.finished, j.snapshot.ID)
+	for len(r.finished) > r.history {
+		delete(r.jobs, r.finished[0])
+		r.finished = r.finished[1:]
+	}
+}
+
+// Cancel stops the job with the given ID. A queued job is cancelled at once;
+// a running job's workers are stopped and its state changes to cancelled when
+// they have finished. It returns ErrNotFound for an unknown job and
+// ErrFinished for one that has already stopped.
+func (r *Registry) Cancel(id string) (Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if j.snapshot.State.Finished() {
+		return j.snapshot, ErrFinished
+	}
+
+	if j == r.running {
+		log.Printf("Cancelling job %s", id)
+		j.cancel()
+		return j.snapshot, nil
+	}
+	for i, waiting := range r.queue {
+		if waiting == j {
+			r.queue = append(r.queue[:i], r.queue[i+1:]...)
+			break
+		}
+	}
+	log.Printf("Job %s cancelled before it started", id)
+	r.drop(j, "cancelled by request")
+	return j.snapshot, nil
+}
+
+// Wait blocks until the running job, if any, has stopped
+func (r *Registry) Wait() {
+	r.wg.Wait()
+}
+
+// Get returns a snapshot of the job with the given ID
+func (r *Registry) Get(id string) (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.snapshot, true
+}
+
+// Subscription follows the changes to one job. It keeps hold of the job, so
+// its snapshot stays available after the job is dropped from the history.
+type Subscription struct {
+	registry *Registry
+	job      *job
+	ch       chan struct{}
+}
+
+// Updates returns a channel that receives a signal whenever the job's
+// snapshot changes and is closed when the job finishes
+func (s *Subscription) Updates() <-chan struct{} {
+	return s.ch
+}
+
+// Snapshot returns the job's current snapshot, which is final once the
+// updates channel is closed
+func (s *Subscription) Snapshot() Job {
+	s.registry.mu.Lock()
+	defer s.registry.mu.Unlock()
+	return s.job.snapshot
+}
+
+// Close stops the updates
+func (s *Subscription) Close() {
+	s.registry.mu.Lock()
+	defer s.registry.mu.Unlock()
+	delete(s.job.subscribers, s.ch)
+}
+
+// Subscribe follows the job with the given ID. The updates channel of a
+// finished job is already closed.
+func (r *Registry) Subscribe(id string) (*Subscription, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok {
+		return nil, false
+	}
+
+	sub := &Subscription{registry: r, job: j, ch: make(chan struct{}, 1)}
+	if j.snapshot.State.Finished() {
+		close(sub.ch)
+		return sub, true
+	}
+
+	if j.subscribers == nil {
+		j.subscribers = make(map[chan struct{}]bool)
+	}
+	j.subscribers[sub.ch] = true
+	return sub, true
+}
+
+// List returns snapshots of all known jobs, newest first
+func (r *Registry) List() []Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]Job, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		list = append(list, j.snapshot)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].CreatedAt.After(list[b].CreatedAt) })
+	return list
+}
+
+// Active returns the number of queued and running jobs
+func (r *Registry) Active() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	active := len(r.queue)
+	if r.running != nil {
+		active++
+	}
+	return active
+}
+
+// LastSubmit returns when the last job was submitted, or the zero time
+func (r *Registry) LastSubmit() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastSubmit
+}
+
+// newID returns a random job ID
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	qdrant "github.com/qdrant/go-client/qdrant"
+)
+
+// Filter restricts searches by MBSItem fields. Set conditions are combined
+// with AND; an empty filter matches every item.
+type Filter struct {
+	Category     StringList `json:"category,omitempty"`
+	Group        StringList `json:"group,omitempty"`
+	SubGroup     StringList `json:"sub_group,omitempty"`
+	ItemType     StringList `json:"item_type,omitempty"`
+	ProviderType StringList `json:"provider_type,omitempty"`
+
+	ScheduleFee *Range `json:"schedule_fee,omitempty"`
+	Benefit75   *Range `json:"benefit_75,omitempty"`
+	Benefit85   *Range `json:"benefit_85,omitempty"`
+	Benefit100  *Range `json:"benefit_100,omitempty"`
+
+	// ActiveOn keeps items whose start date is on or before this date and
+	// whose end date, if any, is on or after it. DD.MM.YYYY or YYYY-MM-DD.
+	ActiveOn string `json:"active_on,omitempty"`
+}
+
+// StringList matches any of its values. In JSON it is a string or an array of strings.
+type StringList []string
+
+// UnmarshalJSON accepts a single string as a one-element list
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = StringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("expected a string or an array of strings")
+	}
+	*l = list
+	return nil
+}
+
+// Range bounds a numeric field. Unset bounds are open.
+type Range struct {
+	GT  *float64 `json:"gt,omitempty"`
+	GTE *float64 `json:"gte,omitempty"`
+	LT  *float64 `json:"lt,omitempty"`
+	LTE *float64 `json:"lte,omitempty"`
+}
+
+// RangeField is a numeric payload field a filter can bound
+type RangeField struct {
+	Key   string  // payload key, as in the JSON filter
+	Range **Range // the filter's bounds for the field
+}
+
+// RangeFields returns the filter's numeric fields, so callers such as the CLI
+// can set bounds by payload key without listing the fields themselves
+func (f *Filter) RangeFields() []RangeField {
+	return []RangeField{
+		{"schedule_fee", &f.ScheduleFee},
+		{"benefit_75", &f.Benefit75},
+		{"benefit_85", &f.Benefit85},
+		{"benefit_100", &f.Benefit100},
+	}
+}
+
+// Validate checks the filter can be translated
+func (f Filter) Validate() error {
+	if f.ActiveOn != "" {
+		if _, ok := ParseDate(f.ActiveOn); !ok {
+			return fmt.Errorf("invalid active_on date %q, expected DD.MM.YYYY or YYYY-MM-DD", f.ActiveOn)
+		}
+	}
+	return nil
+}
+
+// qdrantFilter translates the filter, returning nil if it is empty
+func (f Filter) qdrantFilter() (*qdrant.Filter, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	var must []*qdrant.Condition
+	for _, match := range []struct {
+		key    string
+		values StringList
+	}{
+		{"category", f.Category},
+		{"group", f.Group},
+		{"sub_group", f.SubGroup},
+		{"item_type", f.ItemType},
+		{"provider_type", f.ProviderType},
+	} {
+		if len(match.values) > 0 {
+			must = append(must, matchKeywords(match.key, match.values))
+		}
+	}
+
+	for _, field := range f.RangeFields() {
+		if r := *field.Range; r != nil {
+			must = append(must, rangeCondition(field.Key, &qdrant.Range{Gt: r.GT, Gte: r.GTE, Lt: r.LT, Lte: r.LTE}))
+		}
+	}
+
+	if f.ActiveOn != "" {
+		ymd, _ := ParseDate(f.ActiveOn)
+		date := float64(ymd)
+		startKey := "item_start_date" + DateSuffix
+		endKey := "item_end_date" + DateSuffix
+		must = append(must,
+			anyOf(rangeCondition(startKey, &qdrant.Range{Lte: &date}), isEmpty(startKey)),
+			anyOf(rangeCondition(endKey, &qdrant.Range{Gte: &date}), isEmpty(endKey)),
+		)
+	}
+
+	if len(must) == 0 {
+		return nil, nil
+	}
+	return &qdrant.Filter{Must: must}, nil
+}
+
+// matchKeywords builds a condition matching a keyword payload field against any of values
+func matchKeywords(key string, values []string) *qdrant.Condition {
+	match := &qdrant.Match{MatchValue: &qdrant.Match_Keyword{Keyword: values[0]}}
+	if len(values) > 1 {
+		match = &qdrant.Match{MatchValue: &qdrant.Match_Keywords{Keywords: &qdrant.RepeatedStrings{Strings: values}}}
+	}
+	return &qdrant.Condition{
+		ConditionOneOf: &qdrant.Condition_Field{
+			Field: &qdrant.FieldCondition{Key: key, Match: match},
+		},
+	}
+}
+
+// rangeCondition builds a condition bounding a numeric payload field
+func rangeCondition(key string, r *qdrant.Range) *qdrant.Condition {
+	return &qdrant.Condition{
+		ConditionOneOf: &qdrant.Condition_Field{
+			Field: &qdrant.FieldCondition{Key: key, Range: r},
+		},
+	}
+}
+
+// isEmpty builds a condition matching points where a payload field is missing or empty
+func isEmpty(key string) *qdrant.Condition {
+	return &qdrant.Condition{
+		ConditionOneOf: &qdrant.Condition_IsEmpty{
+			IsEmpty: &qdrant.IsEmptyCondition{Key: key},
+		},
+	}
+}
+
+// anyOf builds a condition matching if any of conditions match
+func anyOf(conditions ...*qdrant.Condition) *qdrant.Condition {
+	return &qdrant.Condition{
+		ConditionOneOf: &qdrant.Condition_Filter{
+			Filter: &qdrant.Filter{Should: conditions},
+		},
+	}
+}
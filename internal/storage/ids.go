@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strconv"
+
+	qdrant "github.com/qdrant/go-client/qdrant"
+
+	"mbsoeg/pkg/models"
+)
+
+// PointNamespace is the UUID namespace for MBS item point IDs. Changing it
+// changes every point ID.
+var PointNamespace = [16]byte{
+	0x3d, 0x1f, 0x6a, 0x52, 0x8b, 0x0e, 0x4c, 0x77,
+	0x9a, 0x41, 0xc2, 0x5e, 0x07, 0xd3, 0x6b, 0x18,
+}
+
+// PointID returns the deterministic UUIDv5 point ID for an item number and
+// sub-item number. Any item number is accepted, including letter suffixes.
+func PointID(itemNum, subItemNum string) string {
+	h := sha1.New()
+	h.Write(PointNamespace[:])
+	h.Write([]byte(itemNum + "\x00" + subItemNum))
+	sum := h.Sum(nil)
+
+	sum[6] = (sum[6] & 0x0f) | 0x50 // version 5
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// ItemPointID returns the point ID of an item
+func ItemPointID(item models.MBSItem) string {
+	return PointID(item.ItemNum, item.SubItemNum)
+}
+
+// PointIDString formats a point ID. Numeric IDs written by earlier versions
+// are formatted in decimal.
+func PointIDString(id *qdrant.PointId) string {
+	if uuid, ok := id.GetPointIdOptions().(*qdrant.PointId_Uuid); ok {
+		return uuid.Uuid
+	}
+	return strconv.FormatUint(id.GetNum(), 10)
+}
+
+// qdrantPointID converts a point ID string to a Qdrant point ID. Decimal
+// strings are numeric IDs, anything else is a UUID.
+func qdrantPointID(id string) (*qdrant.PointId, error) {
+	if id == "" {
+		return nil, fmt.Errorf("empty point ID")
+	}
+	if num, err := strconv.ParseUint(id, 10, 64); err == nil {
+		return &qdrant.PointId{
+			PointIdOptions: &qdrant.PointId_Num{
+				Num: num,
+			},
+		}, nil
+	}
+	return &qdrant.PointId{
+		PointIdOptions: &qdrant.PointId_Uuid{
+			Uuid: id,
+		},
+	}, nil
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	qdrant "github.com/qdrant/go-client/qdrant"
+)
+
+// payloadIndex declares an indexed payload field
+type payloadIndex struct {
+	key       string
+	fieldType qdrant.FieldType
+}
+
+// payloadIndexes are the payload fields indexed for filtering. Dates are
+// indexed through their derived YYYYMMDD integer fields.
+var payloadIndexes = []payloadIndex{
+	{"category", qdrant.FieldType_FieldTypeKeyword},
+	{"group", qdrant.FieldType_FieldTypeKeyword},
+	{"sub_group", qdrant.FieldType_FieldTypeKeyword},
+	{"benefit_type", qdrant.FieldType_FieldTypeKeyword},
+	{"fee_type", qdrant.FieldType_FieldTypeKeyword},
+	{"item_type", qdrant.FieldType_FieldTypeKeyword},
+	{"provider_type", qdrant.FieldType_FieldTypeKeyword},
+	{ItemNumKey, qdrant.FieldType_FieldTypeKeyword},
+
+	{"schedule_fee", qdrant.FieldType_FieldTypeFloat},
+	{"benefit_75", qdrant.FieldType_FieldTypeFloat},
+	{"benefit_85", qdrant.FieldType_FieldTypeFloat},
+	{"benefit_100", qdrant.FieldType_FieldTypeFloat},
+
+	{"item_start_date" + DateSuffix, qdrant.FieldType_FieldTypeInteger},
+	{"item_end_date" + DateSuffix, qdrant.FieldType_FieldTypeInteger},
+	{"fee_start_date" + DateSuffix, qdrant.FieldType_FieldTypeInteger},
+	{"benefit_start_date" + DateSuffix, qdrant.FieldType_FieldTypeInteger},
+}
+
+// ensurePayloadIndexes creates the payload indexes of a collection. Qdrant
+// accepts an index that already exists, so this runs on every startup.
+func (s *Service) ensurePayloadIndexes(ctx context.Context, collection string) error {
+	wait := true
+	for _, index := range payloadIndexes {
+		fieldType := index.fieldType
+		callCtx, cancel := s.callContext(ctx)
+		_, err := s.pointsClient.CreateFieldIndex(callCtx, &qdrant.CreateFieldIndexCollection{
+			CollectionName: collection,
+			Wait:           &wait,
+			FieldName:      index.key,
+			FieldType:      &fieldType,
+		})
+		cancel()
+		if err != nil && !strings.Contains(err.Error(), "already exists") {
+			return fmt.Errorf("failed to create %s index on %s.%s: %v", fieldType, collection, index.key, err)
+		}
+	}
+	return nil
+}
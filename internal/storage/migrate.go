@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	qdrant "github.com/qdrant/go-client/qdrant"
+)
+
+// MigratePointIDs moves points stored under numeric IDs by earlier versions to
+// their UUID point IDs. Vectors and payloads are copied as they are, so nothing
+// is re-embedded. Each batch is written under the new IDs before the old IDs are
+// deleted, so an interrupted migration can simply be run again.
+func (s *Service) MigratePointIDs(ctx context.Context, collectionType string, batchSize int, opts WriteOptions) (int, error) {
+	if batchSize < 1 {
+		batchSize = DefaultScrollPageSize
+	}
+
+	var points []Point
+	var oldIDs []string
+	migrated := 0
+
+	flush := func() error {
+		if len(points) == 0 {
+			return nil
+		}
+		if err := s.UpsertPoints(ctx, points, collectionType, opts); err != nil {
+			return fmt.Errorf("failed to upsert migrated points: %v", err)
+		}
+		if err := s.DeletePoints(ctx, oldIDs, collectionType, opts); err != nil {
+			return fmt.Errorf("failed to delete numeric points: %v", err)
+		}
+		migrated += len(points)
+		log.Printf("Migrated %d points", migrated)
+		points, oldIDs = nil, nil
+		return nil
+	}
+
+	err := s.ScrollEach(ctx, collectionType, ScrollOptions{WithVectors: true}, func(point *qdrant.RetrievedPoint) error {
+		if _, ok := point.Id.GetPointIdOptions().(*qdrant.PointId_Num); !ok {
+			return nil
+		}
+
+		oldID := PointIDString(point.Id)
+		itemNum := PayloadString(point.Payload, ItemNumKey)
+		if itemNum == "" {
+			itemNum = oldID
+		}
+
+		payload := point.Payload
+		if payload == nil {
+			payload = make(map[string]*qdrant.Value)
+		}
+		payload[ItemNumKey] = StringValue(itemNum)
+
+		points = append(points, Point{
+			ID:      PointID(itemNum, PayloadString(payload, SubItemNumKey)),
+			Vector:  point.GetVectors().GetVector().GetData(),
+			Payload: payload,
+		})
+		oldIDs = append(oldIDs, oldID)
+
+		if len(points) >= batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return migrated, err
+	}
+
+	return migrated, flush()
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	qdrant "github.com/qdrant/go-client/qdrant"
+
+	"mbsoeg/pkg/models"
+)
+
+// Sync metadata keys stored alongside the item fields
+const (
+	HashKey        = "_hash"
+	ContentHashKey = "_content_hash"
+	LastCheckKey   = "_last_check"
+)
+
+// PayloadVersion identifies the payload layout. It is part of the metadata
+// hash, so bumping it rewrites every stored payload once on the next sync.
+const PayloadVersion = 2
+
+// DateSuffix is appended to the key of a date field to name its derived
+// YYYYMMDD integer field, which can be indexed and range-filtered
+const DateSuffix = "_ymd"
+
+// dateLayouts are the accepted formats of MBS date fields
+var dateLayouts = []string{"02.01.2006", "2006-01-02", "02/01/2006"}
+
+// Payload keys of the item identifiers
+const (
+	ItemNumKey    = "item_num"
+	SubItemNumKey = "sub_item_num"
+)
+
+// payloadField maps an MBSItem field to its payload key
+type payloadField struct {
+	key   string
+	index []int
+	kind  reflect.Kind
+	date  bool // string date field with a derived YYYYMMDD field
+}
+
+// payloadFields lists the MBSItem fields stored in the payload, from their `payload` tags
+var payloadFields = func() []payloadField {
+	t := reflect.TypeOf(models.MBSItem{})
+	var fields []payloadField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("payload")
+		if !field.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		fields = append(fields, payloadField{
+			key:   key,
+			index: field.Index,
+			kind:  field.Type.Kind(),
+			date:  field.Type.Kind() == reflect.String && strings.HasSuffix(key, "_date"),
+		})
+	}
+	return fields
+}()
+
+// EncodePayload converts an item to Qdrant payload values, keyed by its `payload`
+// tags. Each date field that parses also gets a YYYYMMDD integer field named
+// with DateSuffix.
+func EncodePayload(item models.MBSItem) map[string]*qdrant.Value {
+	v := reflect.ValueOf(item)
+	payload := make(map[string]*qdrant.Value, len(payloadFields))
+	for _, field := range payloadFields {
+		fv := v.FieldByIndex(field.index)
+		switch field.kind {
+		case reflect.String:
+			payload[field.key] = StringValue(fv.String())
+			if ymd, ok := ParseDate(fv.String()); field.date && ok {
+				payload[field.key+DateSuffix] = &qdrant.Value{Kind: &qdrant.Value_IntegerValue{IntegerValue: ymd}}
+			}
+		case reflect.Bool:
+			payload[field.key] = &qdrant.Value{Kind: &qdrant.Value_BoolValue{BoolValue: fv.Bool()}}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			payload[field.key] = &qdrant.Value{Kind: &qdrant.Value_IntegerValue{IntegerValue: fv.Int()}}
+		case reflect.Float32, reflect.Float64:
+			payload[field.key] = &qdrant.Value{Kind: &qdrant.Value_DoubleValue{DoubleValue: fv.Float()}}
+		}
+	}
+	return payload
+}
+
+// DecodePayload rebuilds an item from Qdrant payload values. Missing keys leave
+// the field at its zero value; values of the wrong type are an error.
+func DecodePayload(payload map[string]*qdrant.Value) (models.MBSItem, error) {
+	var item models.MBSItem
+	v := reflect.ValueOf(&item).Elem()
+	for _, field := range payloadFields {
+		value, ok := payload[field.key]
+		if !ok || isNull(value) {
+			continue
+		}
+		fv := v.FieldByIndex(field.index)
+
+		switch field.kind {
+		case reflect.String:
+			k, ok := value.GetKind().(*qdrant.Value_StringValue)
+			if !ok {
+				return item, fmt.Errorf("payload field %s is not a string", field.key)
+			}
+			fv.SetString(k.StringValue)
+		case reflect.Bool:
+			k, ok := value.GetKind().(*qdrant.Value_BoolValue)
+			if !ok {
+				return item, fmt.Errorf("payload field %s is not a boolean", field.key)
+			}
+			fv.SetBool(k.BoolValue)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			switch k := value.GetKind().(type) {
+			case *qdrant.Value_IntegerValue:
+				fv.SetInt(k.IntegerValue)
+			case *qdrant.Value_DoubleValue:
+				if k.DoubleValue != math.Trunc(k.DoubleValue) {
+					return item, fmt.Errorf("payload field %s is not an integer", field.key)
+				}
+				fv.SetInt(int64(k.DoubleValue))
+			default:
+				return item, fmt.Errorf("payload field %s is not an integer", field.key)
+			}
+		case reflect.Float32, reflect.Float64:
+			switch k := value.GetKind().(type) {
+			case *qdrant.Value_DoubleValue:
+				fv.SetFloat(k.DoubleValue)
+			case *qdrant.Value_IntegerValue:
+				fv.SetFloat(float64(k.IntegerValue))
+			default:
+				return item, fmt.Errorf("payload field %s is not a number", field.key)
+			}
+		}
+	}
+	return item, nil
+}
+
+// ParseDate converts an MBS date such as 01.11.2019 to the integer 20191101
+func ParseDate(s string) (int64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return int64(t.Year()*10000 + int(t.Month())*100 + t.Day()), true
+		}
+	}
+	return 0, false
+}
+
+// DecodePoint rebuilds the item stored in a retrieved point
+func DecodePoint(point *qdrant.RetrievedPoint) (models.MBSItem, error) {
+	return DecodePayload(point.GetPayload())
+}
+
+// ItemPayload builds the full payload for an item, including sync metadata
+func ItemPayload(item models.MBSItem, contentHash, metadataHash string) map[string]*qdrant.Value {
+	payload := EncodePayload(item)
+	payload[HashKey] = StringValue(metadataHash)
+	payload[ContentHashKey] = StringValue(contentHash)
+	payload[LastCheckKey] = StringValue(time.Now().Format(time.RFC3339))
+	return payload
+}
+
+// StringValue wraps a string as a Qdrant payload value
+func StringValue(s string) *qdrant.Value {
+	return &qdrant.Value{Kind: &qdrant.Value_StringValue{StringValue: s}}
+}
+
+// PayloadString returns a string payload value, or "" if it is missing
+func PayloadString(payload map[string]*qdrant.Value, key string) string {
+	if value, ok := payload[key]; ok {
+		if str, ok := value.GetKind().(*qdrant.Value_StringValue); ok {
+			return str.StringValue
+		}
+	}
+	return ""
+}
+
+// isNull reports whether a payload value is an explicit null
+func isNull(value *qdrant.Value) bool {
+	_, ok := value.GetKind().(*qdrant.Value_NullValue)
+	return ok
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	qdrant "github.com/qdrant/go-client/qdrant"
+
+	"mbsoeg/pkg/models"
+)
+
+// fullItem returns an item with every field set to a non-zero value
+func fullItem() models.MBSItem {
+	return models.MBSItem{
+		Anaes:                true,
+		AnaesChange:          true,
+		BasicUnits:           5,
+		Benefit100:           100.05,
+		Benefit75:            75.25,
+		Benefit85:            85.45,
+		BenefitChange:        true,
+		BenefitStartDate:     "01.11.2019",
+		BenefitType:          "C",
+		Category:             "3",
+		DerivedFee:           12.5,
+		DerivedFeeStartDate:  "2020-07-01",
+		Description:          "Knee, arthroscopic surgery of",
+		DescriptionStartDate: "01/03/2021",
+		DescriptorChange:     true,
+		EMSNCap:              500.1,
+		EMSNChange:           true,
+		EMSNChangeDate:       "01.01.2022",
+		EMSNDescription:      "EMSN cap applies",
+		EMSNEndDate:          "31.12.2030",
+		EMSNFixedCapAmount:   250.75,
+		EMSNMaximumCap:       1000.99,
+		EMSNPercentageCap:    300,
+		EMSNStartDate:        "01.01.2016",
+		FeeChange:            true,
+		FeeStartDate:         "01.07.2024",
+		FeeType:              "N",
+		Group:                "T8",
+		ItemChange:           true,
+		ItemEndDate:          "30.06.2031",
+		ItemNum:              "49557A",
+		ItemStartDate:        "01.11.1999",
+		ItemType:             "S",
+		NewItem:              true,
+		ProviderType:         "AS",
+		QFEEndDate:           "30.06.2026",
+		QFEStartDate:         "01.07.2025",
+		ScheduleFee:          783.35,
+		SubGroup:             "15",
+		SubHeading:           "Knee",
+		SubItemNum:           "2",
+	}
+}
+
+func TestPayloadRoundTrip(t *testing.T) {
+	item := fullItem()
+
+	// Guard against fields added to MBSItem without a value here
+	v := reflect.ValueOf(item)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			t.Fatalf("fullItem leaves %s unset", v.Type().Field(i).Name)
+		}
+	}
+
+	decoded, err := DecodePayload(EncodePayload(item))
+	if err != nil {
+		t.Fatalf("DecodePayload: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, item) {
+		t.Errorf("round trip changed the item:\ngot  %+v\nwant %+v", decoded, item)
+	}
+}
+
+func TestEncodePayloadDateFields(t *testing.T) {
+	item := models.MBSItem{ItemNum: "23", ItemStartDate: "01.11.2019", ItemEndDate: "not a date"}
+	payload := EncodePayload(item)
+
+	if got := payload["item_start_date"+DateSuffix].GetIntegerValue(); got != 20191101 {
+		t.Errorf("item_start_date%s = %d, want 20191101", DateSuffix, got)
+	}
+	if _, ok := payload["item_end_date"+DateSuffix]; ok {
+		t.Errorf("unparseable date got a derived field")
+	}
+	if _, ok := payload["item_num"+DateSuffix]; ok {
+		t.Errorf("non-date field got a derived field")
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload map[string]*qdrant.Value
+		want    models.MBSItem
+		wantErr bool
+	}{
+		{
+			name:    "missing and null keys keep zero values",
+			payload: map[string]*qdrant.Value{"item_num": StringValue("23"), "category": {Kind: &qdrant.Value_NullValue{}}},
+			want:    models.MBSItem{ItemNum: "23"},
+		},
+		{
+			name:    "whole doubles decode into ints",
+			payload: map[string]*qdrant.Value{"basic_units": {Kind: &qdrant.Value_DoubleValue{DoubleValue: 4}}},
+			want:    models.MBSItem{BasicUnits: 4},
+		},
+		{
+			name:    "integers decode into floats",
+			payload: map[string]*qdrant.Value{"schedule_fee": {Kind: &qdrant.Value_IntegerValue{IntegerValue: 40}}},
+			want:    models.MBSItem{ScheduleFee: 40},
+		},
+		{
+			name:    "fractional double in an int field",
+			payload: map[string]*qdrant.Value{"basic_units": {Kind: &qdrant.Value_DoubleValue{DoubleValue: 4.5}}},
+			wantErr: true,
+		},
+		{
+			name:    "number in a string field",
+			payload: map[string]*qdrant.Value{"item_num": {Kind: &qdrant.Value_IntegerValue{IntegerValue: 23}}},
+			wantErr: true,
+		},
+		{
+			name:    "string in a bool field",
+			payload: map[string]*qdrant.Value{"anaes": StringValue("true")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodePayload(tt.payload)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodePayload: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   int64
+		wantOK bool
+	}{
+		{"01.11.2019", 20191101, true},
+		{" 31.12.1999 ", 19991231, true},
+		{"2024-02-29", 20240229, true},
+		{"15/03/2021", 20210315, true},
+		{"", 0, false},
+		{"30.02.2021", 0, false},
+		{"2021/03/15", 0, false},
+		{"yesterday", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseDate(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParseDate(%q) = %d, %v; want %d, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
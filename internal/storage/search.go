@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	qdrant "github.com/qdrant/go-client/qdrant"
+
+	"mbsoeg/pkg/models"
+)
+
+// SearchOptions limits the results of a search
+type SearchOptions struct {
+	Limit          uint64   // maximum number of results
+	ScoreThreshold *float32 // leave out results scoring worse than this, if set
+	Filter         Filter   // only return matching items
+}
+
+// SearchResult is a stored item ranked by similarity
+type SearchResult struct {
+	ID    string         `json:"id"`
+	Score float32        `json:"score"`
+	Item  models.MBSItem `json:"item"`
+}
+
+// Search returns the items closest to vector, best first
+func (s *Service) Search(ctx context.Context, vector []float32, collectionType string, opts SearchOptions) ([]SearchResult, error) {
+	collection, ok := s.collections[collectionType]
+	if !ok {
+		return nil, fmt.Errorf("invalid collection type: %s", collectionType)
+	}
+
+	filter, err := opts.Filter.qdrantFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+
+	resp, err := s.pointsClient.Search(ctx, &qdrant.SearchPoints{
+		CollectionName: collection,
+		Vector:         vector,
+		Filter:         filter,
+		Limit:          opts.Limit,
+		ScoreThreshold: opts.ScoreThreshold,
+		WithPayload: &qdrant.WithPayloadSelector{
+			SelectorOptions: &qdrant.WithPayloadSelector_Enable{
+				Enable: true,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search points: %v", err)
+	}
+
+	return scoredResults(resp.GetResult())
+}
+
+// scoredResults decodes the items of scored points
+func scoredResults(points []*qdrant.ScoredPoint) ([]SearchResult, error) {
+	results := make([]SearchResult, 0, len(points))
+	for _, point := range points {
+		item, err := DecodePayload(point.GetPayload())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode point %s: %v", PointIDString(point.GetId()), err)
+		}
+		results = append(results, SearchResult{
+			ID:    PointIDString(point.GetId()),
+			Score: point.GetScore(),
+			Item:  item,
+		})
+	}
+	return results, nil
+}
+
+// Similar returns the items closest to the stored point id, best first,
+// reusing its stored vector. The point itself is not included.
+func (s *Service) Similar(ctx context.Context, id string, collectionType string, opts SearchOptions) ([]SearchResult, error) {
+	collection, ok := s.collections[collectionType]
+	if !ok {
+		return nil, fmt.Errorf("invalid collection type: %s", collectionType)
+	}
+
+	pointID, err := qdrantPointID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := opts.Filter.qdrantFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+
+	resp, err := s.pointsClient.Recommend(ctx, &qdrant.RecommendPoints{
+		CollectionName: collection,
+		Positive:       []*qdrant.PointId{pointID},
+		Filter:         filter,
+		Limit:          opts.Limit,
+		ScoreThreshold: opts.ScoreThreshold,
+		WithPayload: &qdrant.WithPayloadSelector{
+			SelectorOptions: &qdrant.WithPayloadSelector_Enable{
+				Enable: true,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to recommend points: %v", err)
+	}
+
+	return scoredResults(resp.GetResult())
+}
+
+// StoredItem is a stored item with its sync metadata
+type StoredItem struct {
+	ID          string         `json:"id"`
+	Item        models.MBSItem `json:"item"`
+	Hash        string         `json:"_hash"`
+	ContentHash string         `json:"_content_hash"`
+	LastCheck   string         `json:"_last_check"`
+}
+
+// GetItem returns the stored item with the given point ID, or nil if there is none
+func (s *Service) GetItem(ctx context.Context, id string, collectionType string) (*StoredItem, error) {
+	point, err := s.GetPoint(ctx, id, collectionType)
+	if err != nil || point == nil {
+		return nil, err
+	}
+
+	item, err := DecodePoint(point)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode point %s: %v", id, err)
+	}
+
+	return &StoredItem{
+		ID:          id,
+		Item:        item,
+		Hash:        PayloadString(point.Payload, HashKey),
+		ContentHash: PayloadString(point.Payload, ContentHashKey),
+		LastCheck:   PayloadString(point.Payload, LastCheckKey),
+	}, nil
+}
+
+// getItemsBatch is the number of points fetched per GetItems request
+const getItemsBatch = 256
+
+// GetItems returns the stored items with the given point IDs, keyed by point
+// ID. IDs with no stored point are left out.
+func (s *Service) GetItems(ctx context.Context, ids []string, collectionType string) (map[string]models.MBSItem, error) {
+	collection, ok := s.collections[collectionType]
+	if !ok {
+		return nil, fmt.Errorf("invalid collection type: %s", collectionType)
+	}
+
+	items := make(map[string]models.MBSItem, len(ids))
+	for start := 0; start < len(ids); start += getItemsBatch {
+		batch := ids[start:min(start+getItemsBatch, len(ids))]
+		pointIDs := make([]*qdrant.PointId, len(batch))
+		for i, id := range batch {
+			pointID, err := qdrantPointID(id)
+			if err != nil {
+				return nil, err
+			}
+			pointIDs[i] = pointID
+		}
+
+		callCtx, cancel := s.callContext(ctx)
+		resp, err := s.pointsClient.Get(callCtx, &qdrant.GetPoints{
+			CollectionName: collection,
+			Ids:            pointIDs,
+			WithPayload: &qdrant.WithPayloadSelector{
+				SelectorOptions: &qdrant.WithPayloadSelector_Enable{
+					Enable: true,
+				},
+			},
+		})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get points: %v", err)
+		}
+
+		for _, point := range resp.GetResult() {
+			item, err := DecodePoint(point)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode point %s: %v", PointIDString(point.GetId()), err)
+			}
+			items[PointIDString(point.GetId())] = item
+		}
+	}
+	return items, nil
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	qdrant "github.com/qdrant/go-client/qdrant"
 	"google.golang.org/grpc"
@@ -14,81 +18,217 @@ import (
 	"mbsoeg/pkg/models"
 )
 
+// DefaultTimeout bounds a single Qdrant call
+const DefaultTimeout = 30 * time.Second
+
 // Service handles interactions with the Qdrant vector database
 type Service struct {
 	client       qdrant.CollectionsClient
 	pointsClient qdrant.PointsClient
 	collections  map[string]string
+	timeout      time.Duration
 }
 
-// NewService creates a new storage service
-func NewService(host string, port int) (*Service, error) {
+// NewService creates a new storage service. timeout bounds each Qdrant call,
+// 0 uses DefaultTimeout.
+func NewService(host string, port int, timeout time.Duration) (*Service, error) {
 	conn, err := grpc.Dial(fmt.Sprintf("%s:%d", host, port), grpc.WithInsecure())
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to Qdrant: %v", err)
 	}
 
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
 	return &Service{
 		client:       qdrant.NewCollectionsClient(conn),
 		pointsClient: qdrant.NewPointsClient(conn),
 		collections: map[string]string{
 			"descriptions": "mbs_codes",
 		},
+		timeout: timeout,
 	}, nil
 }
 
-// InitializeCollection creates the collections if they don't exist
-func (s *Service) InitializeCollection(ctx context.Context) error {
+// callContext derives the context for a single Qdrant call from ctx
+func (s *Service) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// ParseDistance converts a distance metric name such as "cosine" to its Qdrant value
+func ParseDistance(name string) (qdrant.Distance, error) {
+	switch strings.ToLower(name) {
+	case "", "cosine":
+		return qdrant.Distance_Cosine, nil
+	case "euclid", "euclidean":
+		return qdrant.Distance_Euclid, nil
+	case "dot":
+		return qdrant.Distance_Dot, nil
+	case "manhattan":
+		return qdrant.Distance_Manhattan, nil
+	default:
+		return qdrant.Distance_UnknownDistance, fmt.Errorf("unknown distance metric: %s", name)
+	}
+}
+
+// InitializeCollection creates the collections if they don't exist, checks
+// that existing collections hold vectors of the given size and distance, and
+// declares the payload indexes
+func (s *Service) InitializeCollection(ctx context.Context, vectorSize uint64, distance qdrant.Distance) error {
 	for _, collection := range s.collections {
-		_, err := s.client.Create(ctx, &qdrant.CreateCollection{
+		callCtx, cancel := s.callContext(ctx)
+		_, err := s.client.Create(callCtx, &qdrant.CreateCollection{
 			CollectionName: collection,
 			VectorsConfig: &qdrant.VectorsConfig{
 				Config: &qdrant.VectorsConfig_Params{
 					Params: &qdrant.VectorParams{
-						Size:     1536,
-						Distance: qdrant.Distance_Cosine,
+						Size:     vectorSize,
+						Distance: distance,
 					},
 				},
 			},
 		})
-		if err != nil && !strings.Contains(err.Error(), "already exists") {
-			return fmt.Errorf("failed to create collection %s: %v", collection, err)
+		cancel()
+		if err != nil {
+			if !strings.Contains(err.Error(), "already exists") {
+				return fmt.Errorf("failed to create collection %s: %v", collection, err)
+			}
+			if err := s.checkCollection(ctx, collection, vectorSize, distance); err != nil {
+				return err
+			}
 		}
+
+		if err := s.ensurePayloadIndexes(ctx, collection); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCollection verifies an existing collection matches the expected vector parameters
+func (s *Service) checkCollection(ctx context.Context, collection string, vectorSize uint64, distance qdrant.Distance) error {
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+
+	resp, err := s.client.Get(ctx, &qdrant.GetCollectionInfoRequest{CollectionName: collection})
+	if err != nil {
+		return fmt.Errorf("failed to get collection %s: %v", collection, err)
+	}
+
+	params := resp.GetResult().GetConfig().GetParams().GetVectorsConfig().GetParams()
+	if params == nil {
+		return fmt.Errorf("collection %s does not use a single unnamed vector and cannot be used", collection)
+	}
+
+	if params.Size != vectorSize || params.Distance != distance {
+		return fmt.Errorf("collection %s stores %d-dimensional vectors with %s distance, but the embedding configuration produces %d-dimensional vectors with %s distance; "+
+			"recreate the collection or change EMBEDDING_MODEL, EMBEDDING_DIMENSION or QDRANT_DISTANCE to match",
+			collection, params.Size, params.Distance, vectorSize, distance)
 	}
+
 	return nil
 }
 
-// GenerateHash creates a hash of the item's content to detect changes
+// GenerateContentHash creates a hash of the text that is embedded for an item.
+// Only a change to this hash requires a new embedding.
+func (s *Service) GenerateContentHash(text string) string {
+	contentHash := sha256.Sum256([]byte(text))
+
+	return hex.EncodeToString(contentHash[:])
+}
+
+// GenerateHash creates a hash of every MBSItem field to detect metadata changes.
+// Fields are serialized in name order so the hash does not depend on struct
+// layout; fields tagged `hash:"-"` are left out. The PayloadVersion is included
+// so a payload layout change is treated as a metadata change.
 func (s *Service) GenerateHash(item models.MBSItem) string {
-	descriptionContent := fmt.Sprintf("%v-%v-%v-%v-%v-%v-%v-%v-%v-%v-%v-%v-%v-%v-%v-%v-%v",
-		item.ItemNum,
-		item.Description,
-		item.ItemStartDate,
-		item.ItemEndDate,
-		item.FeeStartDate,
-		item.BenefitStartDate,
-		item.DescriptionStartDate,
-		item.EMSNStartDate,
-		item.EMSNEndDate,
-		item.QFEStartDate,
-		item.QFEEndDate,
-		item.DerivedFeeStartDate,
-		item.EMSNChangeDate,
-		item.ScheduleFee,
-		item.Benefit100,
-		item.BenefitType,
-		item.Category,
-	)
-	descriptionHash := sha256.Sum256([]byte(descriptionContent))
-
-	return hex.EncodeToString(descriptionHash[:])
+	return structHash(reflect.ValueOf(item), hashFields)
+}
+
+// structHash hashes the given fields of a struct value in a canonical form
+func structHash(v reflect.Value, fields []reflect.StructField) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "payload_version=%d\n", PayloadVersion)
+	for _, field := range fields {
+		b.WriteString(field.Name)
+		b.WriteByte('=')
+		writeHashValue(&b, v.FieldByIndex(field.Index))
+		b.WriteByte('\n')
+	}
+	metadataHash := sha256.Sum256([]byte(b.String()))
+
+	return hex.EncodeToString(metadataHash[:])
+}
+
+// hashFields lists the MBSItem fields covered by GenerateHash, sorted by name
+var hashFields = hashFieldsOf(reflect.TypeOf(models.MBSItem{}))
+
+// hashFieldsOf lists the exported fields of struct type t that are not tagged
+// `hash:"-"`, sorted by name
+func hashFieldsOf(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("hash") == "-" {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// writeHashValue writes a canonical representation of a field value
+func writeHashValue(b *strings.Builder, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		b.WriteString(strconv.Quote(v.String()))
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		b.WriteString(strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	default:
+		fmt.Fprintf(b, "%#v", v.Interface())
+	}
+}
+
+// Point is a vector and payload to store under a point ID
+type Point struct {
+	ID      string
+	Vector  []float32
+	Payload map[string]*qdrant.Value
+}
+
+// WriteOptions controls how Qdrant applies a write
+type WriteOptions struct {
+	Wait     bool                     // wait until the write has been applied
+	Ordering qdrant.WriteOrderingType // write ordering guarantee, weak by default
+}
+
+// ParseWriteOrdering converts an ordering name such as "strong" to its Qdrant value
+func ParseWriteOrdering(name string) (qdrant.WriteOrderingType, error) {
+	switch strings.ToLower(name) {
+	case "", "weak":
+		return qdrant.WriteOrderingType_Weak, nil
+	case "medium":
+		return qdrant.WriteOrderingType_Medium, nil
+	case "strong":
+		return qdrant.WriteOrderingType_Strong, nil
+	default:
+		return qdrant.WriteOrderingType_Weak, fmt.Errorf("unknown write ordering: %s", name)
+	}
 }
 
 // GetPoint retrieves a point from the specified collection
-func (s *Service) GetPoint(ctx context.Context, itemNum string, collectionType string) (*qdrant.RetrievedPoint, error) {
-	itemID, err := strconv.ParseUint(itemNum, 10, 64)
+func (s *Service) GetPoint(ctx context.Context, id string, collectionType string) (*qdrant.RetrievedPoint, error) {
+	pointID, err := qdrantPointID(id)
 	if err != nil {
-		return nil, fmt.Errorf("error converting ItemNum %s to uint64: %v", itemNum, err)
+		return nil, err
 	}
 
 	collection, ok := s.collections[collectionType]
@@ -96,15 +236,12 @@ func (s *Service) GetPoint(ctx context.Context, itemNum string, collectionType s
 		return nil, fmt.Errorf("invalid collection type: %s", collectionType)
 	}
 
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+
 	resp, err := s.pointsClient.Get(ctx, &qdrant.GetPoints{
 		CollectionName: collection,
-		Ids: []*qdrant.PointId{
-			{
-				PointIdOptions: &qdrant.PointId_Num{
-					Num: itemID,
-				},
-			},
-		},
+		Ids:            []*qdrant.PointId{pointID},
 		WithPayload: &qdrant.WithPayloadSelector{
 			SelectorOptions: &qdrant.WithPayloadSelector_Enable{
 				Enable: true,
@@ -124,10 +261,14 @@ func (s *Service) GetPoint(ctx context.Context, itemNum string, collectionType s
 }
 
 // UpsertPoint updates or inserts a point in the specified collection
-func (s *Service) UpsertPoint(ctx context.Context, itemNum string, vector []float32, payload map[string]interface{}, collectionType string) error {
-	itemID, err := strconv.ParseUint(itemNum, 10, 64)
-	if err != nil {
-		return fmt.Errorf("error converting ItemNum %s to uint64: %v", itemNum, err)
+func (s *Service) UpsertPoint(ctx context.Context, id string, vector []float32, payload map[string]*qdrant.Value, collectionType string) error {
+	return s.UpsertPoints(ctx, []Point{{ID: id, Vector: vector, Payload: payload}}, collectionType, WriteOptions{})
+}
+
+// UpsertPoints updates or inserts several points in a single request
+func (s *Service) UpsertPoints(ctx context.Context, points []Point, collectionType string, opts WriteOptions) error {
+	if len(points) == 0 {
+		return nil
 	}
 
 	collection, ok := s.collections[collectionType]
@@ -135,58 +276,99 @@ func (s *Service) UpsertPoint(ctx context.Context, itemNum string, vector []floa
 		return fmt.Errorf("invalid collection type: %s", collectionType)
 	}
 
-	// Convert payload map to Qdrant values
-	qdrantPayload := make(map[string]*qdrant.Value)
-	for key, value := range payload {
-		switch v := value.(type) {
-		case string:
-			qdrantPayload[key] = &qdrant.Value{Kind: &qdrant.Value_StringValue{StringValue: v}}
-		case bool:
-			qdrantPayload[key] = &qdrant.Value{Kind: &qdrant.Value_BoolValue{BoolValue: v}}
-		case float64:
-			qdrantPayload[key] = &qdrant.Value{Kind: &qdrant.Value_DoubleValue{DoubleValue: v}}
-		case int:
-			qdrantPayload[key] = &qdrant.Value{Kind: &qdrant.Value_IntegerValue{IntegerValue: int64(v)}}
-		case int64:
-			qdrantPayload[key] = &qdrant.Value{Kind: &qdrant.Value_IntegerValue{IntegerValue: v}}
-		case nil:
-			// Skip nil values
-			continue
-		default:
-			// For other types, convert to string
-			qdrantPayload[key] = &qdrant.Value{Kind: &qdrant.Value_StringValue{StringValue: fmt.Sprintf("%v", v)}}
+	structs := make([]*qdrant.PointStruct, len(points))
+	for i, point := range points {
+		id, err := qdrantPointID(point.ID)
+		if err != nil {
+			return err
+		}
+		structs[i] = &qdrant.PointStruct{
+			Id: id,
+			Vectors: &qdrant.Vectors{
+				VectorsOptions: &qdrant.Vectors_Vector{
+					Vector: &qdrant.Vector{
+						Data: point.Vector,
+					},
+				},
+			},
+			Payload: point.Payload,
 		}
 	}
 
-	_, err = s.pointsClient.Upsert(ctx, &qdrant.UpsertPoints{
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+
+	_, err := s.pointsClient.Upsert(ctx, &qdrant.UpsertPoints{
 		CollectionName: collection,
-		Points: []*qdrant.PointStruct{
-			{
-				Id: &qdrant.PointId{
-					PointIdOptions: &qdrant.PointId_Num{
-						Num: itemID,
-					},
-				},
-				Vectors: &qdrant.Vectors{
-					VectorsOptions: &qdrant.Vectors_Vector{
-						Vector: &qdrant.Vector{
-							Data: vector,
+		Wait:           &opts.Wait,
+		Points:         structs,
+		Ordering:       &qdrant.WriteOrdering{Type: opts.Ordering},
+	})
+
+	return err
+}
+
+// OverwritePayload replaces the payload of an existing point, keeping its vector
+func (s *Service) OverwritePayload(ctx context.Context, id string, payload map[string]*qdrant.Value, collectionType string) error {
+	return s.OverwritePayloads(ctx, []Point{{ID: id, Payload: payload}}, collectionType, WriteOptions{})
+}
+
+// OverwritePayloads replaces the payloads of several existing points in a
+// single batch request, keeping their vectors. Point vectors are ignored.
+func (s *Service) OverwritePayloads(ctx context.Context, points []Point, collectionType string, opts WriteOptions) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	collection, ok := s.collections[collectionType]
+	if !ok {
+		return fmt.Errorf("invalid collection type: %s", collectionType)
+	}
+
+	operations := make([]*qdrant.PointsUpdateOperation, len(points))
+	for i, point := range points {
+		pointID, err := qdrantPointID(point.ID)
+		if err != nil {
+			return err
+		}
+		operations[i] = &qdrant.PointsUpdateOperation{
+			Operation: &qdrant.PointsUpdateOperation_OverwritePayload{
+				OverwritePayload: &qdrant.PointsUpdateOperation_SetPayload{
+					Payload: point.Payload,
+					PointsSelector: &qdrant.PointsSelector{
+						PointsSelectorOneOf: &qdrant.PointsSelector_Points{
+							Points: &qdrant.PointsIdsList{
+								Ids: []*qdrant.PointId{pointID},
+							},
 						},
 					},
 				},
-				Payload: qdrantPayload,
 			},
-		},
+		}
+	}
+
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+
+	_, err := s.pointsClient.UpdateBatch(ctx, &qdrant.UpdateBatchPoints{
+		CollectionName: collection,
+		Wait:           &opts.Wait,
+		Operations:     operations,
+		Ordering:       &qdrant.WriteOrdering{Type: opts.Ordering},
 	})
 
 	return err
 }
 
 // DeletePoint removes a point from the specified collection
-func (s *Service) DeletePoint(ctx context.Context, itemNum string, collectionType string) error {
-	itemID, err := strconv.ParseUint(itemNum, 10, 64)
-	if err != nil {
-		return fmt.Errorf("error converting ItemNum %s to uint64: %v", itemNum, err)
+func (s *Service) DeletePoint(ctx context.Context, id string, collectionType string) error {
+	return s.DeletePoints(ctx, []string{id}, collectionType, WriteOptions{})
+}
+
+// DeletePoints removes several points in a single request
+func (s *Service) DeletePoints(ctx context.Context, ids []string, collectionType string, opts WriteOptions) error {
+	if len(ids) == 0 {
+		return nil
 	}
 
 	collection, ok := s.collections[collectionType]
@@ -194,21 +376,29 @@ func (s *Service) DeletePoint(ctx context.Context, itemNum string, collectionTyp
 		return fmt.Errorf("invalid collection type: %s", collectionType)
 	}
 
-	_, err = s.pointsClient.Delete(ctx, &qdrant.DeletePoints{
+	pointIDs := make([]*qdrant.PointId, len(ids))
+	for i, id := range ids {
+		pointID, err := qdrantPointID(id)
+		if err != nil {
+			return err
+		}
+		pointIDs[i] = pointID
+	}
+
+	ctx, cancel := s.callContext(ctx)
+	defer cancel()
+
+	_, err := s.pointsClient.Delete(ctx, &qdrant.DeletePoints{
 		CollectionName: collection,
+		Wait:           &opts.Wait,
 		Points: &qdrant.PointsSelector{
 			PointsSelectorOneOf: &qdrant.PointsSelector_Points{
 				Points: &qdrant.PointsIdsList{
-					Ids: []*qdrant.PointId{
-						{
-							PointIdOptions: &qdrant.PointId_Num{
-								Num: itemID,
-							},
-						},
-					},
+					Ids: pointIDs,
 				},
 			},
 		},
+		Ordering: &qdrant.WriteOrdering{Type: opts.Ordering},
 	})
 
 	return err
@@ -216,41 +406,135 @@ func (s *Service) DeletePoint(ctx context.Context, itemNum string, collectionTyp
 
 // ScrollPoints retrieves all points from the specified collection
 func (s *Service) ScrollPoints(ctx context.Context, collectionType string) ([]*qdrant.RetrievedPoint, error) {
+	var allPoints []*qdrant.RetrievedPoint
+	err := s.ScrollEach(ctx, collectionType, ScrollOptions{}, func(point *qdrant.RetrievedPoint) error {
+		allPoints = append(allPoints, point)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return allPoints, nil
+}
+
+// StoredHashes are the item number and hashes recorded on a stored point
+type StoredHashes struct {
+	ItemNum      string
+	ContentHash  string
+	MetadataHash string
+}
+
+// ScanHashes reads the stored hashes of every point in one scroll, fetching
+// only the item number and hash payload keys and no vectors. The index is
+// keyed by point ID.
+func (s *Service) ScanHashes(ctx context.Context, collectionType string) (map[string]StoredHashes, error) {
+	index := make(map[string]StoredHashes)
+	err := s.ScrollEach(ctx, collectionType, ScrollOptions{
+		Include:  []string{ItemNumKey, HashKey, ContentHashKey},
+		PageSize: 1000,
+	}, func(point *qdrant.RetrievedPoint) error {
+		index[PointIDString(point.Id)] = StoredHashes{
+			ItemNum:      PayloadString(point.Payload, ItemNumKey),
+			ContentHash:  PayloadString(point.Payload, ContentHashKey),
+			MetadataHash: PayloadString(point.Payload, HashKey),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// DefaultScrollPageSize is the number of points fetched per scroll request
+const DefaultScrollPageSize = 100
+
+// ErrStopScroll can be returned by a ScrollEach callback to stop early without an error
+var ErrStopScroll = errors.New("stop scroll")
+
+// ScrollOptions selects the points and fields returned by ScrollEach
+type ScrollOptions struct {
+	Include     []string       // payload keys to return, all keys if empty
+	Exclude     []string       // payload keys to leave out, ignored if Include is set
+	WithVectors bool           // also return vectors
+	Filter      *qdrant.Filter // only return matching points, all points if nil
+	PageSize    uint32         // points per request, DefaultScrollPageSize if 0
+}
+
+// payloadSelector builds the payload selector for the options
+func (o ScrollOptions) payloadSelector() *qdrant.WithPayloadSelector {
+	switch {
+	case len(o.Include) > 0:
+		return &qdrant.WithPayloadSelector{
+			SelectorOptions: &qdrant.WithPayloadSelector_Include{
+				Include: &qdrant.PayloadIncludeSelector{Fields: o.Include},
+			},
+		}
+	case len(o.Exclude) > 0:
+		return &qdrant.WithPayloadSelector{
+			SelectorOptions: &qdrant.WithPayloadSelector_Exclude{
+				Exclude: &qdrant.PayloadExcludeSelector{Fields: o.Exclude},
+			},
+		}
+	default:
+		return &qdrant.WithPayloadSelector{
+			SelectorOptions: &qdrant.WithPayloadSelector_Enable{
+				Enable: true,
+			},
+		}
+	}
+}
+
+// ScrollEach streams the collection page by page, calling fn for each point,
+// so large collections can be processed in constant memory. Each page gets its
+// own call timeout. If fn returns ErrStopScroll the scroll ends without error;
+// any other error ends it and is returned.
+func (s *Service) ScrollEach(ctx context.Context, collectionType string, opts ScrollOptions, fn func(*qdrant.RetrievedPoint) error) error {
 	collection, ok := s.collections[collectionType]
 	if !ok {
-		return nil, fmt.Errorf("invalid collection type: %s", collectionType)
+		return fmt.Errorf("invalid collection type: %s", collectionType)
 	}
 
-	var allPoints []*qdrant.RetrievedPoint
-	var offset *qdrant.PointId
-	var limit uint32 = 100
+	limit := opts.PageSize
+	if limit == 0 {
+		limit = DefaultScrollPageSize
+	}
 
-	for {
-		resp, err := s.pointsClient.Scroll(ctx, &qdrant.ScrollPoints{
-			CollectionName: collection,
-			Limit:          &limit,
-			Offset:         offset,
-			WithPayload: &qdrant.WithPayloadSelector{
-				SelectorOptions: &qdrant.WithPayloadSelector_Enable{
-					Enable: true,
-				},
+	req := &qdrant.ScrollPoints{
+		CollectionName: collection,
+		Filter:         opts.Filter,
+		Limit:          &limit,
+		WithPayload:    opts.payloadSelector(),
+		WithVectors: &qdrant.WithVectorsSelector{
+			SelectorOptions: &qdrant.WithVectorsSelector_Enable{
+				Enable: opts.WithVectors,
 			},
-		})
+		},
+	}
+
+	for {
+		callCtx, cancel := s.callContext(ctx)
+		resp, err := s.pointsClient.Scroll(callCtx, req)
+		cancel()
 		if err != nil {
-			return nil, fmt.Errorf("failed to scroll points: %v", err)
+			return fmt.Errorf("failed to scroll points: %v", err)
 		}
 
-		if len(resp.Result) == 0 {
-			break
+		for _, point := range resp.Result {
+			if err := fn(point); err != nil {
+				if errors.Is(err, ErrStopScroll) {
+					return nil
+				}
+				return err
+			}
 		}
 
-		allPoints = append(allPoints, resp.Result...)
-		if len(resp.Result) < int(limit) {
-			break
+		if resp.NextPageOffset == nil || len(resp.Result) < int(limit) {
+			return nil
 		}
 
-		offset = resp.NextPageOffset
+		req.Offset = resp.NextPageOffset
 	}
-
-	return allPoints, nil
 }
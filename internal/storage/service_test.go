@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStructHashIgnoresFieldOrder(t *testing.T) {
+	type before struct {
+		ItemNum     string
+		ScheduleFee float64
+		Anaes       bool
+		Note        string `hash:"-"`
+	}
+	type after struct {
+		Anaes       bool
+		Note        string `hash:"-"`
+		ScheduleFee float64
+		ItemNum     string
+	}
+
+	a := before{ItemNum: "23", ScheduleFee: 41.4, Anaes: true, Note: "a"}
+	b := after{ItemNum: "23", ScheduleFee: 41.4, Anaes: true, Note: "b"}
+	hashA := structHash(reflect.ValueOf(a), hashFieldsOf(reflect.TypeOf(a)))
+	hashB := structHash(reflect.ValueOf(b), hashFieldsOf(reflect.TypeOf(b)))
+	if hashA != hashB {
+		t.Errorf("reordering fields changed the hash: %s != %s", hashA, hashB)
+	}
+
+	b.ScheduleFee = 42
+	if changed := structHash(reflect.ValueOf(b), hashFieldsOf(reflect.TypeOf(b))); changed == hashA {
+		t.Errorf("changing a field did not change the hash")
+	}
+}
+
+func TestGenerateHash(t *testing.T) {
+	s := &Service{}
+	item := fullItem()
+	hash := s.GenerateHash(item)
+
+	if again := s.GenerateHash(fullItem()); again != hash {
+		t.Errorf("hash is not deterministic: %s != %s", hash, again)
+	}
+
+	// Every field is covered, so changing any one changes the hash
+	v := reflect.ValueOf(&item).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		changed := item
+		reflect.ValueOf(&changed).Elem().Field(i).SetZero()
+		if s.GenerateHash(changed) == hash {
+			t.Errorf("changing %s did not change the hash", v.Type().Field(i).Name)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"mbsoeg/internal/storage"
+	"mbsoeg/pkg/models"
+)
+
+// Plan is what a sync would do, worked out without embedding or writing
+type Plan struct {
+	Summary   PlanSummary  `json:"summary"`
+	New       []string     `json:"new"`
+	Changed   []ItemChange `json:"changed"`
+	Unchanged []string     `json:"unchanged"`
+	Deleted   []string     `json:"deleted"`
+	Retained  []string     `json:"retained,omitempty"`     // missing items kept because deletion is disabled
+	Blocked   string       `json:"delete_guard,omitempty"` // why a real run would be aborted
+	Duration  string       `json:"duration"`
+}
+
+// PlanSummary counts the items in each part of a Plan
+type PlanSummary struct {
+	Total     int `json:"total_items"`
+	New       int `json:"new_items"`
+	Changed   int `json:"changed_items"`
+	Reembed   int `json:"reembed_items"`
+	Unchanged int `json:"unchanged_items"`
+	Deleted   int `json:"deleted_items"`
+}
+
+// ItemChange describes a stored item that differs from the uploaded one
+type ItemChange struct {
+	ItemNum    string   `json:"item_num"`
+	SubItemNum string   `json:"sub_item_num,omitempty"`
+	Fields     []string `json:"fields"`           // MBSItem fields whose values differ
+	Reembed    bool     `json:"reembed"`          // the embedded text changed
+	Reason     string   `json:"reason,omitempty"` // why an item with no differing fields is rewritten
+}
+
+// Reasons an item is rewritten although none of its fields differ
+const (
+	// ReasonPayloadLayout means the payload was stored under an older
+	// payload version or hash scheme and is rewritten in the current one
+	ReasonPayloadLayout = "payload_layout"
+	// ReasonEmbeddingText means the text built from the item for embedding
+	// has changed, so the item is re-embedded
+	ReasonEmbeddingText = "embedding_text"
+)
+
+// DryRun compares items with the collection like Run, but only reads from
+// the vector database and never calls the embedder. Changed items are listed
+// with the fields that differ from their stored payload, or with a Reason if
+// none do, and a run that the deletion limit would abort is reported in
+// Blocked.
+func (s *Syncer) DryRun(ctx context.Context, items []models.MBSItem, runOpts RunOptions) (*Plan, error) {
+	start := time.Now()
+
+	existing, err := s.store.ScanHashes(ctx, s.opts.Collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get existing points: %v", err)
+	}
+
+	currentPoints := make(map[string]bool)
+	r := &run{report: &Report{Total: len(items)}}
+	pending, payloadOnly := s.plan(ctx, items, existing, currentPoints, r)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		New:       []string{},
+		Changed:   []ItemChange{},
+		Unchanged: []string{},
+		Deleted:   []string{},
+	}
+
+	// Sort jobs into new and changed items, remembering which were re-embedded
+	changedJobs := make(map[string]models.EmbeddingJob)
+	reembed := make(map[string]bool)
+	for _, job := range pending {
+		id := storage.ItemPointID(job.Item)
+		if _, ok := existing[id]; !ok {
+			plan.New = append(plan.New, job.ItemNum)
+			continue
+		}
+		changedJobs[id] = job
+		reembed[id] = true
+	}
+	for _, job := range payloadOnly {
+		changedJobs[storage.ItemPointID(job.Item)] = job
+	}
+
+	// Read the stored payloads of changed items to find the fields that differ
+	ids := make([]string, 0, len(changedJobs))
+	for id := range changedJobs {
+		ids = append(ids, id)
+	}
+	stored, err := s.store.GetItems(ctx, ids, s.opts.Collection)
+	if err != nil {
+		return nil, err
+	}
+	for id, job := range changedJobs {
+		change := ItemChange{
+			ItemNum:    job.Item.ItemNum,
+			SubItemNum: job.Item.SubItemNum,
+			Fields:     changedFields(stored[id], job.Item),
+			Reembed:    reembed[id],
+		}
+		if len(change.Fields) == 0 {
+			change.Reason = ReasonPayloadLayout
+			if change.Reembed {
+				change.Reason = ReasonEmbeddingText
+			}
+		}
+		plan.Changed = append(plan.Changed, change)
+	}
+	sort.Slice(plan.Changed, func(i, j int) bool { return plan.Changed[i].ItemNum < plan.Changed[j].ItemNum })
+
+	for _, item := range items {
+		id := storage.ItemPointID(item)
+		if _, ok := existing[id]; ok {
+			if _, ok := changedJobs[id]; !ok {
+				plan.Unchanged = append(plan.Unchanged, item.ItemNum)
+			}
+		}
+	}
+	stale := staleIDs(existing, currentPoints)
+	for _, id := range stale {
+		plan.Deleted = append(plan.Deleted, existing[id].ItemNum)
+	}
+	sort.Strings(plan.Deleted)
+	if runOpts.NoDelete {
+		plan.Retained, plan.Deleted = plan.Deleted, []string{}
+	} else if !runOpts.AllowMassDelete {
+		if err := s.checkDelete(stale, len(existing)); err != nil {
+			plan.Blocked = err.Error()
+		}
+	}
+
+	plan.Summary = PlanSummary{
+		Total:     len(items),
+		New:       len(plan.New),
+		Changed:   len(plan.Changed),
+		Reembed:   len(reembed),
+		Unchanged: len(plan.Unchanged),
+		Deleted:   len(plan.Deleted),
+	}
+	plan.Duration = time.Since(start).Round(time.Millisecond).String()
+	log.Printf("Dry run: %d new, %d changed (%d re-embedded), %d unchanged, %d deleted",
+		plan.Summary.New, plan.Summary.Changed, plan.Summary.Reembed, plan.Summary.Unchanged, plan.Summary.Deleted)
+	return plan, nil
+}
+
+// changedFields lists the names of the MBSItem fields that differ between old and new
+func changedFields(old, new models.MBSItem) []string {
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	t := ov.Type()
+	fields := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			fields = append(fields, t.Field(i).Name)
+		}
+	}
+	return fields
+}
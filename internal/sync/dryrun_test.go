@@ -0,0 +1,51 @@
+package sync
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"mbsoeg/internal/storage"
+	"mbsoeg/pkg/models"
+)
+
+func TestDryRunChanges(t *testing.T) {
+	store := newFakeStore(
+		item("10", "Consultation", 40),
+		item("20", "Arthroscopy", 500),
+		item("30", "Excision", 100),
+		item("40", "Biopsy", 60),
+	)
+	// Item 30 was stored under an older payload layout, so its metadata hash
+	// differs although every field is the same
+	layout := store.points[storage.ItemPointID(item("30", "Excision", 100))]
+	layout.MetadataHash = "old-layout"
+	store.points[storage.ItemPointID(item("30", "Excision", 100))] = layout
+
+	items := []models.MBSItem{
+		item("10", "Consultation", 45),
+		item("20", "Arthroscopy of the knee", 500),
+		item("30", "Excision", 100),
+		item("40", "Biopsy", 60),
+	}
+
+	plan, err := New(nil, store, Options{MaxDelete: NoDeleteLimit}).DryRun(context.Background(), items, RunOptions{})
+	if err != nil {
+		t.Fatalf("DryRun: %v", err)
+	}
+
+	want := []ItemChange{
+		{ItemNum: "10", Fields: []string{"ScheduleFee"}, Reembed: false},
+		{ItemNum: "20", Fields: []string{"Description"}, Reembed: true},
+		{ItemNum: "30", Fields: []string{}, Reembed: false, Reason: ReasonPayloadLayout},
+	}
+	if !reflect.DeepEqual(plan.Changed, want) {
+		t.Errorf("changed = %+v, want %+v", plan.Changed, want)
+	}
+	if want := []string{"40"}; !reflect.DeepEqual(plan.Unchanged, want) {
+		t.Errorf("unchanged = %v, want %v", plan.Unchanged, want)
+	}
+	if plan.Summary.Changed != 3 || plan.Summary.Reembed != 1 {
+		t.Errorf("summary = %+v, want 3 changed, 1 re-embedded", plan.Summary)
+	}
+}
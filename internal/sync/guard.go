@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxDelete is the deletion limit used when none is configured
+const DefaultMaxDelete = "10%"
+
+// RunOptions controls deletion for a single run
+type RunOptions struct {
+	NoDelete        bool `json:"no_delete,omitempty"`         // keep stored items missing from the upload
+	AllowMassDelete bool `json:"allow_mass_delete,omitempty"` // ignore the deletion limit
+}
+
+// DeleteLimit caps how many stored items a run may delete, as a count, a
+// percentage of the stored items, or both. A negative value leaves that part
+// unlimited, so the zero value allows no deletions at all.
+type DeleteLimit struct {
+	Count   int
+	Percent float64
+}
+
+// NoDeleteLimit allows any number of deletions
+var NoDeleteLimit = DeleteLimit{Count: -1, Percent: -1}
+
+// ParseDeleteLimit parses a limit such as "100" or "10%". "0" allows no
+// deletions, and an empty string or "none" means no limit.
+func ParseDeleteLimit(s string) (DeleteLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "none") {
+		return NoDeleteLimit, nil
+	}
+	if percent, ok := strings.CutSuffix(s, "%"); ok {
+		p, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil || p < 0 || p > 100 {
+			return DeleteLimit{}, fmt.Errorf("invalid delete limit %q, expected a count, a percentage between 0%% and 100%% or none", s)
+		}
+		return DeleteLimit{Count: -1, Percent: p}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return DeleteLimit{}, fmt.Errorf("invalid delete limit %q, expected a count, a percentage or none", s)
+	}
+	return DeleteLimit{Count: n, Percent: -1}, nil
+}
+
+// String formats the limit as it would be configured
+func (l DeleteLimit) String() string {
+	switch {
+	case l.Count >= 0 && l.Percent >= 0:
+		return fmt.Sprintf("%d or %g%%", l.Count, l.Percent)
+	case l.Percent >= 0:
+		return fmt.Sprintf("%g%%", l.Percent)
+	case l.Count >= 0:
+		return strconv.Itoa(l.Count)
+	default:
+		return "none"
+	}
+}
+
+// check returns a *MassDeleteError if deleting stale of existing items exceeds the limit
+func (l DeleteLimit) check(stale, existing int) *MassDeleteError {
+	if stale == 0 {
+		return nil
+	}
+	if (l.Count >= 0 && stale > l.Count) ||
+		(l.Percent >= 0 && existing > 0 && float64(stale)*100/float64(existing) > l.Percent) {
+		return &MassDeleteError{Stale: stale, Existing: existing, Limit: l}
+	}
+	return nil
+}
+
+// checkDelete returns a *MassDeleteError if the run may not delete the stale
+// points, noting how many of them are legacy numeric IDs
+func (s *Syncer) checkDelete(stale []string, existing int) error {
+	if err := s.opts.MaxDelete.check(len(stale), existing); err != nil {
+		err.Legacy = countNumericIDs(stale)
+		return err
+	}
+	return nil
+}
+
+// MassDeleteError aborts a run that would delete more items than allowed
+type MassDeleteError struct {
+	Stale    int
+	Existing int
+	Legacy   int // stale points stored under numeric IDs by an earlier version
+	Limit    DeleteLimit
+}
+
+func (e *MassDeleteError) Error() string {
+	if e.Legacy > 0 {
+		return fmt.Sprintf("refusing to delete %d of %d stored items, more than the limit of %s; "+
+			"%d of them have numeric IDs from an earlier version, run 'mbsoeg migrate-ids' to move them to their new IDs first",
+			e.Stale, e.Existing, e.Limit, e.Legacy)
+	}
+	return fmt.Sprintf("refusing to delete %d of %d stored items, more than the limit of %s; "+
+		"check the upload is complete, or allow the deletion explicitly", e.Stale, e.Existing, e.Limit)
+}
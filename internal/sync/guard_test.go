@@ -0,0 +1,220 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mbsoeg/pkg/models"
+)
+
+func TestParseDeleteLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    DeleteLimit
+		wantErr bool
+	}{
+		{"", NoDeleteLimit, false},
+		{"none", NoDeleteLimit, false},
+		{" NONE ", NoDeleteLimit, false},
+		{"0", DeleteLimit{Count: 0, Percent: -1}, false},
+		{"100", DeleteLimit{Count: 100, Percent: -1}, false},
+		{"10%", DeleteLimit{Count: -1, Percent: 10}, false},
+		{"0%", DeleteLimit{Count: -1, Percent: 0}, false},
+		{"2.5 %", DeleteLimit{Count: -1, Percent: 2.5}, false},
+		{"-1", DeleteLimit{}, true},
+		{"101%", DeleteLimit{}, true},
+		{"ten", DeleteLimit{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDeleteLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDeleteLimit(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseDeleteLimit(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDeleteLimitCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    DeleteLimit
+		stale    int
+		existing int
+		blocked  bool
+	}{
+		{"no limit", NoDeleteLimit, 1000, 1000, false},
+		{"nothing stale", DeleteLimit{Count: 0, Percent: 0}, 0, 100, false},
+		{"empty collection", DeleteLimit{Count: 0, Percent: 0}, 0, 0, false},
+		{"zero count blocks any deletion", DeleteLimit{Count: 0, Percent: -1}, 1, 100, true},
+		{"count at limit", DeleteLimit{Count: 5, Percent: -1}, 5, 100, false},
+		{"count over limit", DeleteLimit{Count: 5, Percent: -1}, 6, 100, true},
+		{"percent at limit", DeleteLimit{Count: -1, Percent: 10}, 10, 100, false},
+		{"percent over limit", DeleteLimit{Count: -1, Percent: 10}, 11, 100, true},
+		{"combined within both", DeleteLimit{Count: 20, Percent: 10}, 10, 200, false},
+		{"combined over count", DeleteLimit{Count: 5, Percent: 10}, 6, 1000, true},
+		{"combined over percent", DeleteLimit{Count: 100, Percent: 10}, 11, 100, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limit.check(tt.stale, tt.existing)
+			if (err != nil) != tt.blocked {
+				t.Fatalf("check(%d, %d) with limit %s = %v, want blocked %v", tt.stale, tt.existing, tt.limit, err, tt.blocked)
+			}
+			if err != nil && (err.Stale != tt.stale || err.Existing != tt.existing) {
+				t.Errorf("error reports %d of %d, want %d of %d", err.Stale, err.Existing, tt.stale, tt.existing)
+			}
+		})
+	}
+}
+
+// guardFixture stores ten items and uploads the first five plus a new one,
+// so half of the stored items would be deleted
+func guardFixture() (*fakeStore, []models.MBSItem) {
+	var stored, upload []models.MBSItem
+	for i := 1; i <= 10; i++ {
+		it := item(fmt.Sprint(i), fmt.Sprintf("Item %d", i), 10)
+		stored = append(stored, it)
+		if i <= 5 {
+			upload = append(upload, it)
+		}
+	}
+	upload = append(upload, item("99", "New item", 10))
+	return newFakeStore(stored...), upload
+}
+
+func TestRunDeleteGuard(t *testing.T) {
+	limit := DeleteLimit{Count: -1, Percent: 10}
+
+	t.Run("aborts before writing", func(t *testing.T) {
+		store, upload := guardFixture()
+		report, err := New(&fakeEmbedder{}, store, Options{MaxDelete: limit}).Run(context.Background(), upload, RunOptions{})
+
+		var massDelete *MassDeleteError
+		if !errors.As(err, &massDelete) {
+			t.Fatalf("err = %v, want *MassDeleteError", err)
+		}
+		if massDelete.Stale != 5 || massDelete.Existing != 10 || massDelete.Legacy != 0 {
+			t.Errorf("error = %+v, want 5 of 10 stale, none legacy", massDelete)
+		}
+		if len(store.upserted)+len(store.payloads)+len(store.deleted) != 0 {
+			t.Errorf("aborted run wrote: upserted %v, payloads %v, deleted %v", store.upserted, store.payloads, store.deleted)
+		}
+		if report.Removed != 0 {
+			t.Errorf("removed = %d, want 0", report.Removed)
+		}
+	})
+
+	t.Run("no delete keeps stale items", func(t *testing.T) {
+		store, upload := guardFixture()
+		report, err := New(&fakeEmbedder{}, store, Options{MaxDelete: limit}).Run(context.Background(), upload, RunOptions{NoDelete: true})
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if len(store.deleted) != 0 {
+			t.Errorf("deleted %v", store.deleted)
+		}
+		if report.Retained != 5 || report.Removed != 0 || report.Updated != 1 {
+			t.Errorf("retained = %d, removed = %d, updated = %d; want 5, 0, 1", report.Retained, report.Removed, report.Updated)
+		}
+	})
+
+	t.Run("allow mass delete removes stale items", func(t *testing.T) {
+		store, upload := guardFixture()
+		report, err := New(&fakeEmbedder{}, store, Options{MaxDelete: limit}).Run(context.Background(), upload, RunOptions{AllowMassDelete: true})
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if len(store.deleted) != 5 || report.Removed != 5 {
+			t.Errorf("deleted %v, removed = %d; want 5", store.deleted, report.Removed)
+		}
+	})
+
+	t.Run("zero limit blocks a single deletion", func(t *testing.T) {
+		store := newFakeStore(item("1", "Kept", 10), item("2", "Removed", 10))
+		limit, _ := ParseDeleteLimit("0")
+		_, err := New(&fakeEmbedder{}, store, Options{MaxDelete: limit}).Run(context.Background(), []models.MBSItem{item("1", "Kept", 10)}, RunOptions{})
+
+		var massDelete *MassDeleteError
+		if !errors.As(err, &massDelete) {
+			t.Fatalf("err = %v, want *MassDeleteError", err)
+		}
+		if len(store.deleted) != 0 {
+			t.Errorf("deleted %v", store.deleted)
+		}
+	})
+
+	t.Run("legacy numeric IDs point at migrate-ids", func(t *testing.T) {
+		store := newFakeStore()
+		for i := 1; i <= 10; i++ {
+			it := item(fmt.Sprint(i), fmt.Sprintf("Item %d", i), 10)
+			store.put(fmt.Sprint(i), it)
+		}
+		var upload []models.MBSItem
+		for i := 1; i <= 10; i++ {
+			upload = append(upload, item(fmt.Sprint(i), fmt.Sprintf("Item %d", i), 10))
+		}
+		_, err := New(&fakeEmbedder{}, store, Options{MaxDelete: limit}).Run(context.Background(), upload, RunOptions{})
+
+		var massDelete *MassDeleteError
+		if !errors.As(err, &massDelete) {
+			t.Fatalf("err = %v, want *MassDeleteError", err)
+		}
+		if massDelete.Legacy != 10 || !strings.Contains(err.Error(), "migrate-ids") {
+			t.Errorf("legacy = %d, message %q; want 10 and a pointer to migrate-ids", massDelete.Legacy, err)
+		}
+		if len(store.upserted) != 0 {
+			t.Errorf("aborted run stored %v", store.upserted)
+		}
+	})
+}
+
+func TestDryRunDeleteGuard(t *testing.T) {
+	limit := DeleteLimit{Count: -1, Percent: 10}
+	stale := []string{"10", "6", "7", "8", "9"}
+
+	tests := []struct {
+		name         string
+		opts         RunOptions
+		wantDeleted  []string
+		wantRetained []string
+		wantBlocked  bool
+	}{
+		{"limit exceeded", RunOptions{}, stale, nil, true},
+		{"no delete", RunOptions{NoDelete: true}, []string{}, stale, false},
+		{"allow mass delete", RunOptions{AllowMassDelete: true}, stale, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, upload := guardFixture()
+			plan, err := New(nil, store, Options{MaxDelete: limit}).DryRun(context.Background(), upload, tt.opts)
+			if err != nil {
+				t.Fatalf("DryRun: %v", err)
+			}
+			if !reflect.DeepEqual(plan.Deleted, tt.wantDeleted) {
+				t.Errorf("deleted = %v, want %v", plan.Deleted, tt.wantDeleted)
+			}
+			if !reflect.DeepEqual(plan.Retained, tt.wantRetained) {
+				t.Errorf("retained = %v, want %v", plan.Retained, tt.wantRetained)
+			}
+			if (plan.Blocked != "") != tt.wantBlocked {
+				t.Errorf("blocked = %q, want blocked %v", plan.Blocked, tt.wantBlocked)
+			}
+			if len(store.upserted)+len(store.payloads)+len(store.deleted) != 0 {
+				t.Errorf("dry run wrote to the store")
+			}
+			if want := []string{"99"}; !reflect.DeepEqual(plan.New, want) {
+				t.Errorf("new = %v, want %v", plan.New, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,473 @@
+// Package sync brings a Qdrant collection in line with an uploaded MBS schedule.
+// It is shared by the server and CLI entry points.
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"mbsoeg/internal/embeddings"
+	"mbsoeg/internal/storage"
+	"mbsoeg/pkg/models"
+)
+
+// DefaultCollection is the collection type synced when none is configured
+const DefaultCollection = "descriptions"
+
+// Defaults for buffering Qdrant writes
+const (
+	DefaultWriteBatchSize = 64
+	DefaultFlushInterval  = 2 * time.Second
+)
+
+// Embedder generates embeddings for batches of jobs
+type Embedder interface {
+	EmbedJobs(ctx context.Context, jobs []models.EmbeddingJob) []models.EmbeddingResult
+}
+
+// Store reads and writes points in the vector database
+type Store interface {
+	GenerateHash(item models.MBSItem) string
+	GenerateContentHash(text string) string
+	UpsertPoints(ctx context.Context, points []storage.Point, collectionType string, opts storage.WriteOptions) error
+	OverwritePayloads(ctx context.Context, points []storage.Point, collectionType string, opts storage.WriteOptions) error
+	DeletePoints(ctx context.Context, ids []string, collectionType string, opts storage.WriteOptions) error
+	ScanHashes(ctx context.Context, collectionType string) (map[string]storage.StoredHashes, error)
+	GetItems(ctx context.Context, ids []string, collectionType string) (map[string]models.MBSItem, error)
+}
+
+// Options configures a Syncer
+type Options struct {
+	NumWorkers  int
+	BatchSize   int    // maximum items per embeddings request
+	BatchTokens int    // maximum estimated tokens per embeddings request
+	Collection  string // collection type, DefaultCollection if empty
+
+	WriteBatchSize int                  // maximum points per upsert, payload or delete request
+	FlushInterval  time.Duration        // longest a stored result waits in the write buffer
+	Write          storage.WriteOptions // wait and ordering for upserts and deletes
+
+	MaxDelete DeleteLimit // most stored items a run may delete unless allowed
+}
+
+// ItemError records why a single item could not be synced
+type ItemError struct {
+	ItemNum string `json:"item_num"`
+	Error   string `json:"error"`
+}
+
+// Phase is a stage of a sync run
+type Phase string
+
+// Sync phases, in the order a run moves through them
+const (
+	PhaseLock    Phase = "lock"    // waiting for another run on the collection to finish
+	PhaseScan    Phase = "scan"    // reading stored hashes
+	PhaseDiff    Phase = "diff"    // comparing items with stored hashes
+	PhasePayload Phase = "payload" // overwriting payloads where only metadata changed
+	PhaseEmbed   Phase = "embed"   // embedding changed items and storing full batches
+	PhaseUpsert  Phase = "upsert"  // storing the last buffered points
+	PhaseDelete  Phase = "delete"  // removing stale items
+	PhaseDone    Phase = "done"
+)
+
+// Report summarises a sync run
+type Report struct {
+	Phase     Phase       `json:"phase,omitempty"`
+	Total     int         `json:"total_items"`
+	Queued    int         `json:"queued_items"`
+	Embedded  int         `json:"embedded_items"`
+	Skipped   int         `json:"skipped_items"`
+	Updated   int         `json:"updated_items"`
+	Payload   int         `json:"payload_updated_items"`
+	Removed   int         `json:"removed_items"`
+	Retained  int         `json:"retained_items,omitempty"` // stale items kept by NoDelete
+	Failed    int         `json:"failed_items"`
+	Cancelled bool        `json:"cancelled,omitempty"`
+	Errors    []ItemError `json:"errors,omitempty"`
+	Duration  string      `json:"duration"`
+}
+
+// collectionLocks holds a one-slot semaphore per collection type so only one
+// run in the process writes to a collection at a time
+var collectionLocks sync.Map
+
+// lockCollection blocks until the run holds the collection's write lock or
+// ctx ends, and returns the function that releases the lock
+func lockCollection(ctx context.Context, collection string) (func(), error) {
+	sem, _ := collectionLocks.LoadOrStore(collection, make(chan struct{}, 1))
+	select {
+	case sem.(chan struct{}) <- struct{}{}:
+		return func() { <-sem.(chan struct{}) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Syncer embeds new and changed items, stores them and removes stale ones
+type Syncer struct {
+	embedder Embedder
+	store    Store
+	opts     Options
+}
+
+// New creates a Syncer
+func New(embedder Embedder, store Store, opts Options) *Syncer {
+	if opts.NumWorkers < 1 {
+		opts.NumWorkers = 1
+	}
+	if opts.Collection == "" {
+		opts.Collection = DefaultCollection
+	}
+	if opts.WriteBatchSize < 1 {
+		opts.WriteBatchSize = DefaultWriteBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	return &Syncer{embedder: embedder, store: store, opts: opts}
+}
+
+// Observer is told the counts so far each time they change during a run.
+// It is called from the goroutine running the sync and must not block.
+type Observer interface {
+	Progress(report Report)
+}
+
+// run is the state of a single sync run
+type run struct {
+	report    *Report
+	observers []Observer
+}
+
+// enter moves the run to a new phase
+func (r *run) enter(phase Phase) {
+	log.Printf("Sync phase: %s", phase)
+	r.report.Phase = phase
+	r.notify()
+}
+
+// notify sends a snapshot of the report to the run's observers
+func (r *run) notify() {
+	for _, observer := range r.observers {
+		observer.Progress(*r.report)
+	}
+}
+
+// Run syncs the collection with items, reporting progress to observers. Runs
+// on the same collection within the process are serialized, since each
+// removes the points the other did not see. A run that would delete more
+// stored items than MaxDelete allows is aborted with a *MassDeleteError before
+// anything is written. If ctx is cancelled the workers stop, no items are
+// removed, and the report records how far the run got.
+func (s *Syncer) Run(ctx context.Context, items []models.MBSItem, runOpts RunOptions, observers ...Observer) (*Report, error) {
+	start := time.Now()
+	report := &Report{Total: len(items)}
+	r := &run{report: report, observers: observers}
+	defer func() {
+		report.Duration = time.Since(start).Round(time.Millisecond).String()
+		r.notify()
+	}()
+
+	// Wait for any other writer to finish with the collection
+	r.enter(PhaseLock)
+	unlock, err := lockCollection(ctx, s.opts.Collection)
+	if err != nil {
+		report.Cancelled = true
+		return report, err
+	}
+	defer unlock()
+
+	// Get the stored hashes of existing points from Qdrant
+	r.enter(PhaseScan)
+	log.Printf("Getting existing points from Qdrant...")
+	existing, err := s.store.ScanHashes(ctx, s.opts.Collection)
+	if err != nil {
+		return report, fmt.Errorf("failed to get existing points: %v", err)
+	}
+	log.Printf("Got %d existing points from Qdrant", len(existing))
+	if legacy := countNumericIDs(mapKeys(existing)); legacy > 0 {
+		log.Printf("Warning: %d points have numeric IDs from an earlier version and will be re-created; run 'mbsoeg migrate-ids' first to keep their vectors", legacy)
+	}
+
+	// Work out which items need embedding or a payload update
+	r.enter(PhaseDiff)
+	currentPoints := make(map[string]bool)
+	pending, payloadOnly := s.plan(ctx, items, existing, currentPoints, r)
+	report.Queued = len(pending)
+
+	// Check the deletions before writing anything, since a truncated upload
+	// would otherwise wipe most of the collection
+	stale := staleIDs(existing, currentPoints)
+	if ctx.Err() == nil && !runOpts.NoDelete && !runOpts.AllowMassDelete {
+		if err := s.checkDelete(stale, len(existing)); err != nil {
+			log.Printf("Aborting sync: %v", err)
+			return report, err
+		}
+	}
+
+	// Update payloads in place where only metadata changed
+	r.enter(PhasePayload)
+	s.updatePayloads(ctx, payloadOnly, r)
+
+	// Embed and store the pending items
+	r.enter(PhaseEmbed)
+	s.process(ctx, pending, r)
+
+	// Leave existing items in place if the sync was cancelled
+	if ctx.Err() != nil {
+		report.Cancelled = true
+		log.Printf("Processing cancelled after storing %d of %d queued items: %v", report.Updated, len(pending), ctx.Err())
+		return report, ctx.Err()
+	}
+
+	// Remove items that no longer exist, unless deletion is turned off
+	r.enter(PhaseDelete)
+	if runOpts.NoDelete {
+		report.Retained = len(stale)
+		log.Printf("Keeping %d items missing from the upload (deletion disabled)", len(stale))
+	} else {
+		s.remove(ctx, stale, existing, r)
+	}
+
+	// Print summary
+	log.Printf("Processing complete:")
+	log.Printf("- Items processed: %d", report.Total)
+	log.Printf("- Items skipped (unchanged): %d", report.Skipped)
+	log.Printf("- Items updated: %d", report.Updated)
+	log.Printf("- Items with payload-only updates: %d", report.Payload)
+	log.Printf("- Items failed: %d", report.Failed)
+	log.Printf("- Items removed: %d", report.Removed)
+	if report.Retained > 0 {
+		log.Printf("- Items retained (deletion disabled): %d", report.Retained)
+	}
+
+	report.Phase = PhaseDone
+	return report, nil
+}
+
+// plan compares each item's hashes with the stored ones in existing. It returns embedding
+// jobs for new items and items whose embedded text changed, and payload-only
+// jobs for items where just the metadata changed. Every item's point ID is
+// recorded in currentPoints so it is not removed.
+func (s *Syncer) plan(ctx context.Context, items []models.MBSItem, existing map[string]storage.StoredHashes, currentPoints map[string]bool, r *run) (pending, payloadOnly []models.EmbeddingJob) {
+	for i, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("Checking item %d/%d: %s", i+1, len(items), item.ItemNum)
+		id := storage.ItemPointID(item)
+		currentPoints[id] = true
+
+		// Check if item needs updating
+		text := EmbeddingText(item)
+		job := models.EmbeddingJob{
+			ItemNum:     item.ItemNum,
+			Text:        text,
+			Item:        item,
+			NewHash:     s.store.GenerateHash(item),
+			ContentHash: s.store.GenerateContentHash(text),
+		}
+
+		stored, ok := existing[id]
+		if !ok {
+			log.Printf("Item %s is new (hash: %s)", item.ItemNum, job.NewHash)
+			pending = append(pending, job)
+			continue
+		}
+
+		switch {
+		case stored.ContentHash != job.ContentHash:
+			log.Printf("Item %s text has changed (old hash: %s, new hash: %s)", item.ItemNum, stored.ContentHash, job.ContentHash)
+			pending = append(pending, job)
+		case stored.MetadataHash != job.NewHash:
+			log.Printf("Item %s metadata has changed (old hash: %s, new hash: %s)", item.ItemNum, stored.MetadataHash, job.NewHash)
+			payloadOnly = append(payloadOnly, job)
+		default:
+			log.Printf("Skipping unchanged item %s (hash: %s)", item.ItemNum, job.NewHash)
+			r.report.Skipped++
+			r.notify()
+		}
+	}
+	return pending, payloadOnly
+}
+
+// updatePayloads overwrites the payload of items whose embedded text is
+// unchanged, reusing the stored vector, in batches of WriteBatchSize
+func (s *Syncer) updatePayloads(ctx context.Context, jobs []models.EmbeddingJob, r *run) {
+	for start := 0; start < len(jobs); start += s.opts.WriteBatchSize {
+		if ctx.Err() != nil {
+			return
+		}
+		batch := jobs[start:min(start+s.opts.WriteBatchSize, len(jobs))]
+		points := make([]storage.Point, len(batch))
+		for i, job := range batch {
+			points[i] = storage.Point{
+				ID:      storage.ItemPointID(job.Item),
+				Payload: storage.ItemPayload(job.Item, job.ContentHash, job.NewHash),
+			}
+		}
+		if err := s.store.OverwritePayloads(ctx, points, s.opts.Collection, s.opts.Write); err != nil {
+			log.Printf("Error updating %d payloads starting at item %s: %v", len(batch), batch[0].ItemNum, err)
+			for _, job := range batch {
+				s.fail(r, job.ItemNum, err)
+			}
+			continue
+		}
+		r.report.Payload += len(batch)
+		r.notify()
+	}
+}
+
+// process embeds pending jobs on the worker pool and stores each result
+func (s *Syncer) process(ctx context.Context, pending []models.EmbeddingJob, r *run) {
+	jobBatches := embeddings.BatchJobs(pending, s.opts.BatchSize, s.opts.BatchTokens)
+	batches := make(chan []models.EmbeddingJob, len(jobBatches))
+	results := make(chan models.EmbeddingResult, len(pending))
+
+	// Start workers
+	var wg sync.WaitGroup
+	for w := 1; w <= s.opts.NumWorkers; w++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			for batch := range batches {
+				log.Printf("Worker %d processing batch of %d items starting at %s", workerID, len(batch), batch[0].ItemNum)
+				for _, result := range s.embedder.EmbedJobs(ctx, batch) {
+					results <- result
+				}
+			}
+		}(w)
+	}
+
+	// Queue batches of jobs
+	for _, batch := range jobBatches {
+		batches <- batch
+	}
+	close(batches)
+	log.Printf("Queued %d items for processing in %d batches", len(pending), len(jobBatches))
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Buffer results as they arrive and store them in batches
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var buffer []models.EmbeddingResult
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				r.enter(PhaseUpsert)
+				s.flush(ctx, buffer, r)
+				return
+			}
+			if result.Error != nil {
+				log.Printf("Error processing item %s, it was not stored: %v", result.ItemNum, result.Error)
+				s.fail(r, result.ItemNum, result.Error)
+				continue
+			}
+			r.report.Embedded++
+			r.notify()
+			buffer = append(buffer, result)
+			if len(buffer) >= s.opts.WriteBatchSize {
+				s.flush(ctx, buffer, r)
+				buffer = nil
+			}
+		case <-ticker.C:
+			s.flush(ctx, buffer, r)
+			buffer = nil
+		}
+	}
+}
+
+// flush upserts buffered results in one request. If it fails, every item in
+// the batch is recorded as failed.
+func (s *Syncer) flush(ctx context.Context, results []models.EmbeddingResult, r *run) {
+	if len(results) == 0 {
+		return
+	}
+
+	points := make([]storage.Point, len(results))
+	for i, result := range results {
+		points[i] = storage.Point{
+			ID:      storage.ItemPointID(result.Item),
+			Vector:  result.Vector,
+			Payload: storage.ItemPayload(result.Item, result.ContentHash, result.NewHash),
+		}
+	}
+
+	log.Printf("Storing %d items in Qdrant starting at %s...", len(results), results[0].ItemNum)
+	if err := s.store.UpsertPoints(ctx, points, s.opts.Collection, s.opts.Write); err != nil {
+		log.Printf("Error upserting %d points starting at %s: %v", len(results), results[0].ItemNum, err)
+		for _, result := range results {
+			s.fail(r, result.ItemNum, err)
+		}
+		return
+	}
+	r.report.Updated += len(results)
+	r.notify()
+}
+
+// remove deletes stale points in batches of WriteBatchSize
+func (s *Syncer) remove(ctx context.Context, ids []string, existing map[string]storage.StoredHashes, r *run) {
+	for start := 0; start < len(ids); start += s.opts.WriteBatchSize {
+		batch := ids[start:min(start+s.opts.WriteBatchSize, len(ids))]
+		if err := s.store.DeletePoints(ctx, batch, s.opts.Collection, s.opts.Write); err != nil {
+			log.Printf("Error deleting %d points starting at item %s: %v", len(batch), existing[batch[0]].ItemNum, err)
+			continue
+		}
+		r.report.Removed += len(batch)
+		r.notify()
+	}
+}
+
+// staleIDs returns the stored point IDs that are not in currentPoints
+func staleIDs(existing map[string]storage.StoredHashes, currentPoints map[string]bool) []string {
+	var stale []string
+	for id := range existing {
+		if !currentPoints[id] {
+			stale = append(stale, id)
+		}
+	}
+	return stale
+}
+
+// countNumericIDs counts point IDs stored as numbers by earlier versions
+func countNumericIDs(ids []string) int {
+	count := 0
+	for _, id := range ids {
+		if _, err := strconv.ParseUint(id, 10, 64); err == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// mapKeys returns the point IDs in existing
+func mapKeys(existing map[string]storage.StoredHashes) []string {
+	ids := make([]string, 0, len(existing))
+	for id := range existing {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// fail records an item that could not be synced
+func (s *Syncer) fail(r *run, itemNum string, err error) {
+	r.report.Failed++
+	r.report.Errors = append(r.report.Errors, ItemError{ItemNum: itemNum, Error: err.Error()})
+	r.notify()
+}
+
+// EmbeddingText returns the exact text embedded for an item
+func EmbeddingText(item models.MBSItem) string {
+	return fmt.Sprintf("MBS Item %s: %s", item.ItemNum, item.Description)
+}
@@ -0,0 +1,395 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"mbsoeg/internal/storage"
+	"mbsoeg/pkg/models"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// hasher computes hashes the same way as the real store
+var hasher = &storage.Service{}
+
+// fakeStore keeps points in memory and records every write
+type fakeStore struct {
+	mu        sync.Mutex
+	points    map[string]storage.StoredHashes
+	items     map[string]models.MBSItem
+	upsertErr error
+
+	upserted []string // item numbers, in write order
+	payloads []string
+	deleted  []string
+
+	payloadBatches int
+}
+
+func newFakeStore(items ...models.MBSItem) *fakeStore {
+	store := &fakeStore{
+		points: make(map[string]storage.StoredHashes),
+		items:  make(map[string]models.MBSItem),
+	}
+	for _, item := range items {
+		store.put(storage.ItemPointID(item), item)
+	}
+	return store
+}
+
+// put stores an item under id with the hashes a sync would have written
+func (f *fakeStore) put(id string, item models.MBSItem) {
+	f.points[id] = storage.StoredHashes{
+		ItemNum:      item.ItemNum,
+		ContentHash:  hasher.GenerateContentHash(EmbeddingText(item)),
+		MetadataHash: hasher.GenerateHash(item),
+	}
+	f.items[id] = item
+}
+
+func (f *fakeStore) GenerateHash(item models.MBSItem) string { return hasher.GenerateHash(item) }
+func (f *fakeStore) GenerateContentHash(text string) string  { return hasher.GenerateContentHash(text) }
+
+func (f *fakeStore) UpsertPoints(ctx context.Context, points []storage.Point, collectionType string, opts storage.WriteOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.upsertErr != nil {
+		return f.upsertErr
+	}
+	for _, point := range points {
+		f.upserted = append(f.upserted, storage.PayloadString(point.Payload, storage.ItemNumKey))
+	}
+	return nil
+}
+
+func (f *fakeStore) OverwritePayloads(ctx context.Context, points []storage.Point, collectionType string, opts storage.WriteOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.payloadBatches++
+	for _, point := range points {
+		f.payloads = append(f.payloads, storage.PayloadString(point.Payload, storage.ItemNumKey))
+	}
+	return nil
+}
+
+func (f *fakeStore) DeletePoints(ctx context.Context, ids []string, collectionType string, opts storage.WriteOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		f.deleted = append(f.deleted, f.points[id].ItemNum)
+	}
+	return nil
+}
+
+func (f *fakeStore) ScanHashes(ctx context.Context, collectionType string) (map[string]storage.StoredHashes, error) {
+	index := make(map[string]storage.StoredHashes, len(f.points))
+	for id, hashes := range f.points {
+		index[id] = hashes
+	}
+	return index, nil
+}
+
+func (f *fakeStore) GetItems(ctx context.Context, ids []string, collectionType string) (map[string]models.MBSItem, error) {
+	items := make(map[string]models.MBSItem)
+	for _, id := range ids {
+		if item, ok := f.items[id]; ok {
+			items[id] = item
+		}
+	}
+	return items, nil
+}
+
+// fakeEmbedder returns a fixed vector for every job. If cancel is set it is
+// called before embedding and every job fails with the context's error.
+type fakeEmbedder struct {
+	cancel context.CancelFunc
+}
+
+func (e *fakeEmbedder) EmbedJobs(ctx context.Context, jobs []models.EmbeddingJob) []models.EmbeddingResult {
+	if e.cancel != nil {
+		e.cancel()
+	}
+	results := make([]models.EmbeddingResult, len(jobs))
+	for i, job := range jobs {
+		results[i] = models.EmbeddingResult{
+			ItemNum:     job.ItemNum,
+			Item:        job.Item,
+			NewHash:     job.NewHash,
+			ContentHash: job.ContentHash,
+			Error:       ctx.Err(),
+		}
+		if ctx.Err() == nil {
+			results[i].Vector = []float32{1, 0}
+		}
+	}
+	return results
+}
+
+func item(num, description string, fee float64) models.MBSItem {
+	return models.MBSItem{ItemNum: num, Description: description, ScheduleFee: fee}
+}
+
+func jobItemNums(jobs []models.EmbeddingJob) []string {
+	nums := make([]string, len(jobs))
+	for i, job := range jobs {
+		nums[i] = job.ItemNum
+	}
+	return nums
+}
+
+func TestPlan(t *testing.T) {
+	store := newFakeStore(
+		item("10", "Consultation", 40),
+		item("20", "Arthroscopy", 500),
+		item("30", "Excision", 100),
+	)
+	items := []models.MBSItem{
+		item("10", "Consultation", 40),             // unchanged
+		item("20", "Arthroscopy of the knee", 500), // text changed
+		item("30", "Excision", 110),                // fee changed
+		item("40", "Biopsy", 60),                   // new
+	}
+
+	s := New(&fakeEmbedder{}, store, Options{})
+	existing, _ := store.ScanHashes(context.Background(), DefaultCollection)
+	currentPoints := make(map[string]bool)
+	r := &run{report: &Report{}}
+	pending, payloadOnly := s.plan(context.Background(), items, existing, currentPoints, r)
+
+	if got, want := jobItemNums(pending), []string{"20", "40"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pending = %v, want %v", got, want)
+	}
+	if got, want := jobItemNums(payloadOnly), []string{"30"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("payload-only = %v, want %v", got, want)
+	}
+	if r.report.Skipped != 1 {
+		t.Errorf("skipped = %d, want 1", r.report.Skipped)
+	}
+	for _, it := range items {
+		if !currentPoints[storage.ItemPointID(it)] {
+			t.Errorf("item %s missing from current points", it.ItemNum)
+		}
+	}
+}
+
+func TestStaleIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		current  []string
+		want     []string
+	}{
+		{"empty collection", nil, []string{"a"}, nil},
+		{"all current", []string{"a", "b"}, []string{"a", "b"}, nil},
+		{"some stale", []string{"a", "b", "c"}, []string{"b"}, []string{"a", "c"}},
+		{"empty upload", []string{"a", "b"}, nil, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := make(map[string]storage.StoredHashes)
+			for _, id := range tt.existing {
+				existing[id] = storage.StoredHashes{}
+			}
+			current := make(map[string]bool)
+			for _, id := range tt.current {
+				current[id] = true
+			}
+
+			got := staleIDs(existing, current)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("staleIDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	store := newFakeStore(
+		item("10", "Consultation", 40),
+		item("20", "Arthroscopy", 500),
+		item("30", "Excision", 100),
+		item("50", "Removed", 10),
+	)
+	items := []models.MBSItem{
+		item("10", "Consultation", 40),
+		item("20", "Arthroscopy of the knee", 500),
+		item("30", "Excision", 110),
+		item("40", "Biopsy", 60),
+	}
+
+	s := New(&fakeEmbedder{}, store, Options{MaxDelete: NoDeleteLimit})
+	report, err := s.Run(context.Background(), items, RunOptions{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	sort.Strings(store.upserted)
+	if want := []string{"20", "40"}; !reflect.DeepEqual(store.upserted, want) {
+		t.Errorf("upserted = %v, want %v", store.upserted, want)
+	}
+	if want := []string{"30"}; !reflect.DeepEqual(store.payloads, want) {
+		t.Errorf("payload updates = %v, want %v", store.payloads, want)
+	}
+	if want := []string{"50"}; !reflect.DeepEqual(store.deleted, want) {
+		t.Errorf("deleted = %v, want %v", store.deleted, want)
+	}
+
+	want := Report{Phase: PhaseDone, Total: 4, Queued: 2, Embedded: 2, Skipped: 1, Updated: 2, Payload: 1, Removed: 1}
+	report.Duration = ""
+	if !reflect.DeepEqual(*report, want) {
+		t.Errorf("report = %+v, want %+v", *report, want)
+	}
+}
+
+func TestRunBatchesPayloadUpdates(t *testing.T) {
+	var stored, upload []models.MBSItem
+	for i := 1; i <= 5; i++ {
+		stored = append(stored, item(fmt.Sprint(i), fmt.Sprintf("Item %d", i), 10))
+		upload = append(upload, item(fmt.Sprint(i), fmt.Sprintf("Item %d", i), 20))
+	}
+	store := newFakeStore(stored...)
+
+	report, err := New(&fakeEmbedder{}, store, Options{WriteBatchSize: 2, MaxDelete: NoDeleteLimit}).Run(context.Background(), upload, RunOptions{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if store.payloadBatches != 3 || report.Payload != 5 {
+		t.Errorf("payload batches = %d, payload = %d; want 3, 5", store.payloadBatches, report.Payload)
+	}
+	if len(store.upserted) != 0 {
+		t.Errorf("upserted %v, want none", store.upserted)
+	}
+}
+
+func TestRunCancelledDeletesNothing(t *testing.T) {
+	store := newFakeStore(
+		item("10", "Consultation", 40),
+		item("50", "Removed", 10),
+	)
+	items := []models.MBSItem{
+		item("10", "Consultation", 40),
+		item("40", "Biopsy", 60),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := New(&fakeEmbedder{cancel: cancel}, store, Options{MaxDelete: NoDeleteLimit})
+	report, err := s.Run(ctx, items, RunOptions{})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if !report.Cancelled {
+		t.Errorf("report not marked cancelled")
+	}
+	if len(store.deleted) != 0 {
+		t.Errorf("cancelled run deleted %v", store.deleted)
+	}
+	if len(store.upserted) != 0 {
+		t.Errorf("cancelled run stored %v", store.upserted)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	results := []models.EmbeddingResult{
+		{ItemNum: "10", Item: item("10", "Consultation", 40), Vector: []float32{1}},
+		{ItemNum: "20", Item: item("20", "Arthroscopy", 500), Vector: []float32{1}},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		store := newFakeStore()
+		s := New(&fakeEmbedder{}, store, Options{})
+		r := &run{report: &Report{}}
+		s.flush(context.Background(), results, r)
+
+		if r.report.Updated != 2 || r.report.Failed != 0 {
+			t.Errorf("updated = %d, failed = %d; want 2, 0", r.report.Updated, r.report.Failed)
+		}
+	})
+
+	t.Run("failure fails every item in the batch", func(t *testing.T) {
+		store := newFakeStore()
+		store.upsertErr = errors.New("qdrant unavailable")
+		s := New(&fakeEmbedder{}, store, Options{})
+		r := &run{report: &Report{}}
+		s.flush(context.Background(), results, r)
+
+		if r.report.Updated != 0 || r.report.Failed != 2 {
+			t.Errorf("updated = %d, failed = %d; want 0, 2", r.report.Updated, r.report.Failed)
+		}
+		want := []ItemError{{ItemNum: "10", Error: "qdrant unavailable"}, {ItemNum: "20", Error: "qdrant unavailable"}}
+		if !reflect.DeepEqual(r.report.Errors, want) {
+			t.Errorf("errors = %+v, want %+v", r.report.Errors, want)
+		}
+	})
+
+	t.Run("empty buffer writes nothing", func(t *testing.T) {
+		store := newFakeStore()
+		s := New(&fakeEmbedder{}, store, Options{})
+		r := &run{report: &Report{}}
+		s.flush(context.Background(), nil, r)
+
+		if len(store.upserted) != 0 || r.report.Updated != 0 {
+			t.Errorf("empty flush wrote %v", store.upserted)
+		}
+	})
+}
+
+// phaseRecorder records each phase a run reports, in order
+type phaseRecorder struct {
+	phases []Phase
+}
+
+func (p *phaseRecorder) Progress(report Report) {
+	if n := len(p.phases); n == 0 || p.phases[n-1] != report.Phase {
+		p.phases = append(p.phases, report.Phase)
+	}
+}
+
+func TestRunPhaseOrder(t *testing.T) {
+	store := newFakeStore(item("10", "Consultation", 40))
+	recorder := &phaseRecorder{}
+	s := New(&fakeEmbedder{}, store, Options{MaxDelete: NoDeleteLimit})
+	if _, err := s.Run(context.Background(), []models.MBSItem{item("40", "Biopsy", 60)}, RunOptions{}, recorder); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := []Phase{PhaseLock, PhaseScan, PhaseDiff, PhasePayload, PhaseEmbed, PhaseUpsert, PhaseDelete, PhaseDone}
+	if !reflect.DeepEqual(recorder.phases, want) {
+		t.Errorf("phases = %v, want %v", recorder.phases, want)
+	}
+}
+
+func TestLockCollectionHonoursContext(t *testing.T) {
+	unlock, err := lockCollection(context.Background(), "lock-test")
+	if err != nil {
+		t.Fatalf("lockCollection: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := lockCollection(ctx, "lock-test"); !errors.Is(err, context.Canceled) {
+		t.Errorf("second lock err = %v, want context.Canceled", err)
+	}
+
+	unlock()
+	unlock, err = lockCollection(context.Background(), "lock-test")
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	unlock()
+}
@@ -1,47 +1,52 @@
 package models
 
+import "time"
+
+// MBSItem is a single item of the Medicare Benefits Schedule. Every field is
+// covered by the change-detection hash unless tagged `hash:"-"`, and stored in
+// the Qdrant payload under its `payload` tag name unless tagged `payload:"-"`.
 type MBSItem struct {
-	Anaes                bool    `json:"Anaes"`
-	AnaesChange          bool    `json:"AnaesChange"`
-	BasicUnits           int     `json:"BasicUnits"`
-	Benefit100           float64 `json:"Benefit100"`
-	Benefit75            float64 `json:"Benefit75"`
-	Benefit85            float64 `json:"Benefit85"`
-	BenefitChange        bool    `json:"BenefitChange"`
-	BenefitStartDate     string  `json:"BenefitStartDate"`
-	BenefitType          string  `json:"BenefitType"`
-	Category             string  `json:"Category"`
-	DerivedFee           float64 `json:"DerivedFee"`
-	DerivedFeeStartDate  string  `json:"DerivedFeeStartDate"`
-	Description          string  `json:"Description"`
-	DescriptionStartDate string  `json:"DescriptionStartDate"`
-	DescriptorChange     bool    `json:"DescriptorChange"`
-	EMSNCap              float64 `json:"EMSNCap"`
-	EMSNChange           bool    `json:"EMSNChange"`
-	EMSNChangeDate       string  `json:"EMSNChangeDate"`
-	EMSNDescription      string  `json:"EMSNDescription"`
-	EMSNEndDate          string  `json:"EMSNEndDate"`
-	EMSNFixedCapAmount   float64 `json:"EMSNFixedCapAmount"`
-	EMSNMaximumCap       float64 `json:"EMSNMaximumCap"`
-	EMSNPercentageCap    float64 `json:"EMSNPercentageCap"`
-	EMSNStartDate        string  `json:"EMSNStartDate"`
-	FeeChange            bool    `json:"FeeChange"`
-	FeeStartDate         string  `json:"FeeStartDate"`
-	FeeType              string  `json:"FeeType"`
-	Group                string  `json:"Group"`
-	ItemChange           bool    `json:"ItemChange"`
-	ItemEndDate          string  `json:"ItemEndDate"`
-	ItemNum              string  `json:"ItemNum"`
-	ItemStartDate        string  `json:"ItemStartDate"`
-	ItemType             string  `json:"ItemType"`
-	NewItem              bool    `json:"NewItem"`
-	ProviderType         string  `json:"ProviderType"`
-	QFEEndDate           string  `json:"QFEEndDate"`
-	QFEStartDate         string  `json:"QFEStartDate"`
-	ScheduleFee          float64 `json:"ScheduleFee"`
-	SubGroup             string  `json:"SubGroup"`
-	SubHeading           string  `json:"SubHeading"`
-	SubItemNum           string  `json:"SubItemNum"`
+	Anaes                bool    `json:"Anaes" payload:"anaes"`
+	AnaesChange          bool    `json:"AnaesChange" payload:"anaes_change"`
+	BasicUnits           int     `json:"BasicUnits" payload:"basic_units"`
+	Benefit100           float64 `json:"Benefit100" payload:"benefit_100"`
+	Benefit75            float64 `json:"Benefit75" payload:"benefit_75"`
+	Benefit85            float64 `json:"Benefit85" payload:"benefit_85"`
+	BenefitChange        bool    `json:"BenefitChange" payload:"benefit_change"`
+	BenefitStartDate     string  `json:"BenefitStartDate" payload:"benefit_start_date"`
+	BenefitType          string  `json:"BenefitType" payload:"benefit_type"`
+	Category             string  `json:"Category" payload:"category"`
+	DerivedFee           float64 `json:"DerivedFee" payload:"derived_fee"`
+	DerivedFeeStartDate  string  `json:"DerivedFeeStartDate" payload:"derived_fee_start_date"`
+	Description          string  `json:"Description" payload:"description"`
+	DescriptionStartDate string  `json:"DescriptionStartDate" payload:"description_start_date"`
+	DescriptorChange     bool    `json:"DescriptorChange" payload:"descriptor_change"`
+	EMSNCap              float64 `json:"EMSNCap" payload:"emsn_cap"`
+	EMSNChange           bool    `json:"EMSNChange" payload:"emsn_change"`
+	EMSNChangeDate       string  `json:"EMSNChangeDate" payload:"emsn_change_date"`
+	EMSNDescription      string  `json:"EMSNDescription" payload:"emsn_description"`
+	EMSNEndDate          string  `json:"EMSNEndDate" payload:"emsn_end_date"`
+	EMSNFixedCapAmount   float64 `json:"EMSNFixedCapAmount" payload:"emsn_fixed_cap_amount"`
+	EMSNMaximumCap       float64 `json:"EMSNMaximumCap" payload:"emsn_maximum_cap"`
+	EMSNPercentageCap    float64 `json:"EMSNPercentageCap" payload:"emsn_percentage_cap"`
+	EMSNStartDate        string  `json:"EMSNStartDate" payload:"emsn_start_date"`
+	FeeChange            bool    `json:"FeeChange" payload:"fee_change"`
+	FeeStartDate         string  `json:"FeeStartDate" payload:"fee_start_date"`
+	FeeType              string  `json:"FeeType" payload:"fee_type"`
+	Group                string  `json:"Group" payload:"group"`
+	ItemChange           bool    `json:"ItemChange" payload:"item_change"`
+	ItemEndDate          string  `json:"ItemEndDate" payload:"item_end_date"`
+	ItemNum              string  `json:"ItemNum" payload:"item_num"`
+	ItemStartDate        string  `json:"ItemStartDate" payload:"item_start_date"`
+	ItemType             string  `json:"ItemType" payload:"item_type"`
+	NewItem              bool    `json:"NewItem" payload:"new_item"`
+	ProviderType         string  `json:"ProviderType" payload:"provider_type"`
+	QFEEndDate           string  `json:"QFEEndDate" payload:"qfe_end_date"`
+	QFEStartDate         string  `json:"QFEStartDate" payload:"qfe_start_date"`
+	ScheduleFee          float64 `json:"ScheduleFee" payload:"schedule_fee"`
+	SubGroup             string  `json:"SubGroup" payload:"sub_group"`
+	SubHeading           string  `json:"SubHeading" payload:"sub_heading"`
+	SubItemNum           string  `json:"SubItemNum" payload:"sub_item_num"`
 }
 
 type Config struct {
@@ -51,6 +56,43 @@ type Config struct {
 	APIKey       string
 	ServerPort   int
 	ServerAPIKey string
+
+	// Per-call timeouts
+	EmbeddingTimeout time.Duration
+	QdrantTimeout    time.Duration
+
+	// Embedding provider selection
+	EmbeddingProvider    string
+	EmbeddingModel       string
+	EmbeddingBaseURL     string
+	EmbeddingAPIVersion  string
+	EmbeddingDimension   int
+	EmbeddingCachePath   string
+	VectorDistance       string
+	EmbeddingMaxAttempts int
+	EmbeddingMaxWait     time.Duration // longest provider-requested retry wait honoured
+
+	// Embedding rate limits per minute, 0 for the model defaults
+	EmbeddingRPM int
+	EmbeddingTPM int
+
+	// Embedding batch limits
+	EmbeddingBatchSize   int
+	EmbeddingBatchTokens int
+
+	// Qdrant write batching
+	QdrantWriteBatchSize int
+	QdrantFlushInterval  time.Duration
+	QdrantWait           bool
+	QdrantWriteOrdering  string
+
+	// Finished sync jobs kept for status polling, and what to do with a sync
+	// requested while another is active: reject, queue or coalesce
+	JobHistory      int
+	SyncConcurrency string
+
+	// Most stored items a sync may delete, as a count or a percentage such as "10%"
+	MaxDelete string
 }
 
 type ProcessResponse struct {
@@ -62,16 +104,18 @@ type ProcessResponse struct {
 }
 
 type EmbeddingJob struct {
-	ItemNum string
-	Text    string
-	Item    MBSItem
-	NewHash string
+	ItemNum     string
+	Text        string
+	Item        MBSItem
+	NewHash     string // hash of the payload fields
+	ContentHash string // hash of the embedded text
 }
 
 type EmbeddingResult struct {
-	ItemNum string
-	Vector  []float32
-	Item    MBSItem
-	NewHash string
-	Error   error
+	ItemNum     string
+	Vector      []float32
+	Item        MBSItem
+	NewHash     string
+	ContentHash string
+	Error       error
 }